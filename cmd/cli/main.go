@@ -3,35 +3,115 @@ package main
 import (
 	"context"
 	"fmt"
+	"localiza-compra/backend/internal/api/product"
+	"localiza-compra/backend/internal/api/role"
+	"localiza-compra/backend/internal/api/stock"
 	"localiza-compra/backend/internal/api/user"
+	"localiza-compra/backend/internal/config"
 	"localiza-compra/backend/internal/database"
+	"localiza-compra/backend/internal/mailer"
+	"log"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 func main() {
 	args := os.Args
-	if len(args) < 4 {
-		fmt.Println("Uso: go run ./cmd/cli/main.go promote <email> <role>")
+	if len(args) < 2 {
+		printUsage()
 		return
 	}
 
-	command := args[1]
-	email := args[2]
-	role := args[3]
+	switch args[1] {
+	case "promote":
+		promote(args[2:])
+	case "import-stock":
+		importStock(args[2:])
+	case "migrate":
+		runMigrate(args[2:])
+	default:
+		fmt.Println("Comando inválido. Use 'promote', 'import-stock' ou 'migrate'.")
+		printUsage()
+	}
+}
+
+func printUsage() {
+	fmt.Println("Uso:")
+	fmt.Println("  go run ./cmd/cli/main.go promote <email> <role> [storeID]")
+	fmt.Println("  go run ./cmd/cli/main.go import-stock <storeID> <arquivo.csv|arquivo.json> [--dry-run]")
+	fmt.Println("  go run ./cmd/cli/main.go migrate up|down [N]|status")
+}
+
+// loadConfig lê a mesma configuração do servidor, mas só exige o que a CLI usa.
+func loadConfig() config.Config {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Erro ao ler a configuração: %v", err)
+	}
+	if err := cfg.ValidateDatabase(); err != nil {
+		log.Fatalf("Configuração inválida:\n%v", err)
+	}
+	return cfg
+}
+
+func connect() *pgxpool.Pool {
+	cfg := loadConfig()
+
+	db, err := database.Connect(cfg.DatabaseURL, cfg.Pool())
+	if err != nil {
+		log.Fatal(err)
+	}
+	return db
+}
+
+func promote(args []string) {
+	if len(args) < 2 {
+		fmt.Println("Uso: go run ./cmd/cli/main.go promote <email> <role> [storeID]")
+		return
+	}
 
-	if command != "promote" {
-		fmt.Println("Comando inválido. Use 'promote'.")
+	email := args[0]
+	newRole, err := role.Parse(args[1])
+	if err != nil {
+		fmt.Println(err)
 		return
 	}
 
-	fmt.Printf("A promover o utilizador %s para o cargo %s...\n", email, role)
+	var storeID *int64
+	if len(args) > 2 {
+		id, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil {
+			fmt.Println("ID da loja inválido.")
+			return
+		}
+		storeID = &id
+	}
 
-	db := database.Connect()
+	fmt.Printf("A promover o utilizador %s para o cargo %s...\n", email, newRole)
+
+	db := connect()
 	defer db.Close()
 
 	userRepo := user.NewRepository(db)
+	// A troca de cargo não envia e-mails nem emite tokens
+	userService := user.NewService(userRepo, user.TokenConfig{}, mailer.NewLogMailer(), "")
+
+	target, err := userRepo.GetByEmail(context.Background(), email)
+	if err != nil {
+		fmt.Printf("Erro ao promover o utilizador: %v\n", err)
+		return
+	}
 
-	err := userRepo.UpdateRole(context.Background(), email, role)
+	_, err = userService.ChangeRole(context.Background(), user.RoleChange{
+		UserID:     target.ID,
+		NewRole:    newRole,
+		NewStoreID: storeID,
+		Source:     user.RoleChangeSourceCLI,
+	})
 	if err != nil {
 		fmt.Printf("Erro ao promover o utilizador: %v\n", err)
 		return
@@ -39,3 +119,121 @@ func main() {
 
 	fmt.Println("Utilizador promovido com sucesso!")
 }
+
+func importStock(args []string) {
+	dryRun := false
+	positional := make([]string, 0, 2)
+	for _, arg := range args {
+		if arg == "--dry-run" {
+			dryRun = true
+			continue
+		}
+		positional = append(positional, arg)
+	}
+
+	if len(positional) < 2 {
+		fmt.Println("Uso: go run ./cmd/cli/main.go import-stock <storeID> <arquivo.csv|arquivo.json> [--dry-run]")
+		return
+	}
+
+	storeID, err := strconv.ParseInt(positional[0], 10, 64)
+	if err != nil {
+		fmt.Println("ID da loja inválido.")
+		return
+	}
+
+	path := positional[1]
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Printf("Erro ao abrir o arquivo: %v\n", err)
+		return
+	}
+	defer file.Close()
+
+	rows, err := stock.ParseImport(file, format)
+	if err != nil {
+		fmt.Printf("Erro ao ler o arquivo: %v\n", err)
+		return
+	}
+
+	db := connect()
+	defer db.Close()
+
+	stockService := stock.NewService(stock.NewRepository(db), product.NewRepository(db))
+
+	report, err := stockService.Import(context.Background(), storeID, rows, dryRun)
+	if err != nil {
+		fmt.Printf("Erro ao importar o estoque: %v\n", err)
+		return
+	}
+
+	for _, row := range report.Rows {
+		if row.Status == stock.ImportStatusRejected {
+			fmt.Printf("Linha %d: rejeitada (%s)\n", row.Line, row.Error)
+		}
+	}
+
+	if dryRun {
+		fmt.Printf("Simulação concluída: %d criados, %d atualizados, %d rejeitados. Nada foi gravado.\n", report.Created, report.Updated, report.Rejected)
+		return
+	}
+	fmt.Printf("Importação concluída: %d criados, %d atualizados, %d rejeitados.\n", report.Created, report.Updated, report.Rejected)
+}
+
+func runMigrate(args []string) {
+	if len(args) < 1 {
+		fmt.Println("Uso: go run ./cmd/cli/main.go migrate up|down [N]|status")
+		return
+	}
+
+	databaseUrl := loadConfig().DatabaseURL
+
+	switch args[0] {
+	case "up":
+		if err := database.MigrateUp(databaseUrl); err != nil {
+			fmt.Printf("Erro ao aplicar as migrações: %v\n", err)
+			return
+		}
+		fmt.Println("Migrações aplicadas com sucesso!")
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				fmt.Println("O número de migrações a desfazer precisa ser maior que zero.")
+				return
+			}
+			steps = n
+		}
+		if err := database.MigrateDown(databaseUrl, steps); err != nil {
+			fmt.Printf("Erro ao desfazer as migrações: %v\n", err)
+			return
+		}
+		fmt.Printf("%d migração(ões) desfeita(s) com sucesso!\n", steps)
+
+	case "status":
+		status, err := database.GetMigrationStatus(databaseUrl)
+		if err != nil {
+			fmt.Printf("Erro ao consultar as migrações: %v\n", err)
+			return
+		}
+
+		fmt.Printf("Versão atual: %d\n", status.Version)
+		if status.Dirty {
+			fmt.Println("ATENÇÃO: a última migração falhou no meio e o banco está marcado como sujo.")
+		}
+		for _, m := range status.Migrations {
+			mark := "pendente"
+			if m.Applied {
+				mark = "aplicada"
+			}
+			fmt.Printf("  %06d  %-50s %s\n", m.Version, m.Name, mark)
+		}
+
+	default:
+		fmt.Println("Subcomando inválido. Use 'up', 'down' ou 'status'.")
+	}
+}
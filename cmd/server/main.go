@@ -1,43 +1,89 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"localiza-compra/backend/internal/api/category"
+	"localiza-compra/backend/internal/api/health"
 	"localiza-compra/backend/internal/api/middleware"
 	"localiza-compra/backend/internal/api/product"
 	"localiza-compra/backend/internal/api/shoppinglist"
 	"localiza-compra/backend/internal/api/stock"
 	"localiza-compra/backend/internal/api/store"
 	"localiza-compra/backend/internal/api/user"
+	"localiza-compra/backend/internal/config"
 	"localiza-compra/backend/internal/database"
 	"log"
 	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+	_ "time/tzdata" // fusos horários das lojas mesmo em imagens sem zoneinfo
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/cors"
 )
 
 func main() {
-	db := database.Connect()
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Erro ao ler a configuração: %v", err)
+	}
+	// Configuração inválida impede a subida, em vez de falhar na primeira requisição
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Configuração inválida:\n%v", err)
+	}
+
+	// Com AUTO_MIGRATE=true o servidor aplica as migrações pendentes antes de subir
+	if cfg.AutoMigrate {
+		if err := database.MigrateUp(cfg.DatabaseURL); err != nil {
+			log.Fatalf("Erro ao aplicar as migrações: %v", err)
+		}
+		log.Println("Migrações aplicadas.")
+	}
+
+	db, err := database.Connect(cfg.DatabaseURL, cfg.Pool())
+	if err != nil {
+		log.Fatal(err)
+	}
 	defer db.Close()
 
+	healthHandler := health.NewHandler(db)
+
+	mail, err := cfg.NewMailer()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	geo, err := cfg.NewGeocoder()
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	productRepo := product.NewRepository(db)
 	productService := product.NewService(productRepo)
 	productHandler := product.NewHandler(productService)
 
 	userRepo := user.NewRepository(db)
-	userService := user.NewService(userRepo)
-	userHandler := user.NewHandler(userService)
+	userService := user.NewService(userRepo, user.TokenConfig{
+		Secret:     cfg.JWTSecret,
+		AccessTTL:  cfg.AccessTokenTTL,
+		RefreshTTL: cfg.RefreshTokenTTL,
+	}, mail, cfg.AppURL)
+	userHandler := user.NewHandler(userService, cfg.IsProduction())
 
 	storeRepo := store.NewRepository(db)
-	storeService := store.NewService(db, storeRepo, userRepo)
+	storeService := store.NewService(db, storeRepo, userRepo, mail, geo, cfg.JWTSecret, cfg.AppURL)
 	storeHandler := store.NewHandler(storeService)
 
 	stockItemRepo := stock.NewRepository(db)
-	stockItemService := stock.NewService(stockItemRepo)
+	stockItemService := stock.NewService(stockItemRepo, productRepo)
 	stockItemHandler := stock.NewHandler(stockItemService)
 
 	shoppinglistRepo := shoppinglist.NewRepository(db)
-	shoppinglistService := shoppinglist.NewService(shoppinglistRepo)
+	// Eventos das listas em tempo real, distribuídos dentro deste processo
+	listEvents := shoppinglist.NewBroker()
+	shoppinglistService := shoppinglist.NewService(shoppinglistRepo, productRepo, storeService, listEvents, mail, cfg.AppURL)
 	shoppinglistHandler := shoppinglist.NewHandler(shoppinglistService)
 
 	categoryRepo := category.NewRepository(db)
@@ -47,30 +93,38 @@ func main() {
 	r := chi.NewRouter()
 
 	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"http://localhost:3005"},
+		AllowedOrigins:   cfg.CORSOrigins,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "Last-Event-ID"},
 		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
 
-	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(`{"status": "ok", "database": "connected"}`))
-	})
+	// /health continua como liveness para quem já usa
+	r.Get("/health", healthHandler.Live)
+	r.Get("/health/live", healthHandler.Live)
+	r.Get("/health/ready", healthHandler.Ready)
 
 	r.Route("/api/v1", func(r chi.Router) {
 
 		// --- Sub-grupo de Rotas Públicas ---
 		r.Group(func(r chi.Router) {
 			r.Post("/login", userHandler.Login)
+			r.Post("/refresh", userHandler.Refresh)
 			r.Get("/logout", userHandler.Logout)
+			r.Post("/logout", userHandler.Logout)
 			r.Post("/users", userHandler.Create)
+			r.Post("/password-reset", userHandler.RequestPasswordReset)
+			r.Post("/password-reset/confirm", userHandler.ResetPassword)
+			r.Post("/email-verification/confirm", userHandler.VerifyEmail)
+			r.Post("/email-change/confirm", userHandler.ConfirmEmailChange)
 			r.Route("/products", func(r chi.Router) {
 				r.Get("/", productHandler.GetAll)
-				// Nossa nova rota de busca!
-				r.Get("/search", productHandler.SearchByName)
+				// Busca textual com ranking, filtros e paginação
+				r.Get("/search", productHandler.Search)
+				r.Get("/barcode/{code}", productHandler.GetByBarcode)
+				r.Get("/{productID}/price-history", stockItemHandler.GetPriceHistory)
 			})
 			r.Get("/categories", categoryHandler.GetAll)
 			r.Post("/stores", storeHandler.CreateStoreWithAdmin)
@@ -78,32 +132,95 @@ func main() {
 
 		// --- Sub-grupo de Rotas Protegidas ---
 		r.Group(func(r chi.Router) {
-			r.Use(middleware.Auth) // Segurança geral para este grupo
+			r.Use(middleware.Auth(cfg.JWTSecret, userService)) // Segurança geral para este grupo
 
-			r.Get("/users/me", userHandler.GetMe)
+			r.Route("/users/me", func(r chi.Router) {
+				r.Get("/", userHandler.GetMe)
+				r.Patch("/", userHandler.UpdateMe)
+				r.Delete("/", userHandler.DeleteMe)
+				r.Post("/email", userHandler.RequestEmailChange)
+				r.Put("/password", userHandler.ChangePassword)
+				// Exportação dos dados pessoais (LGPD)
+				r.Get("/export", userHandler.ExportMe)
+			})
+			// Encerra todas as sessões do usuário, em todos os dispositivos
+			r.Post("/logout-all", userHandler.LogoutAll)
+			r.Post("/email-verification", userHandler.SendEmailVerification)
+			r.Post("/staff-invitations/accept", storeHandler.AcceptInvitation)
 			r.Get("/stores", storeHandler.GetAll)
+			// Lojas perto de um ponto ou CEP, da mais próxima para a mais distante
+			r.Get("/stores/nearby", storeHandler.Nearby)
 
 			// Rotas de Listas de Compras do utilizador
 			r.Route("/shopping-lists", func(r chi.Router) {
 				r.Post("/", shoppinglistHandler.CreateList)
 				r.Get("/", shoppinglistHandler.GetAllByUserID)
+				// Convites recebidos pelo usuário logado
+				r.Get("/invitations", shoppinglistHandler.ListUserInvitations)
+				r.Post("/invitations/{invitationID}/accept", shoppinglistHandler.AcceptInvitation)
+				r.Delete("/invitations/{invitationID}", shoppinglistHandler.DeclineInvitation)
 				r.Route("/{listID}", func(r chi.Router) {
+					r.Patch("/", shoppinglistHandler.RenameList)
+					r.Delete("/", shoppinglistHandler.DeleteList)
 					r.Get("/optimize", shoppinglistHandler.GetOptimizedList)
+					r.Get("/compare", shoppinglistHandler.CompareStores)
+					r.Get("/split", shoppinglistHandler.SplitBasket)
+					// Stream (Server-Sent Events) com as mudanças nos itens
+					r.Get("/events", shoppinglistHandler.Events)
+
+					// Compartilhamento: editores mexem nos itens, viewers só veem
+					r.Get("/members", shoppinglistHandler.ListMembers)
+					r.Post("/members", shoppinglistHandler.ShareList)
+					r.Delete("/members/{userID}", shoppinglistHandler.RemoveMember)
+					r.Get("/invitations", shoppinglistHandler.ListInvitations)
+					r.Delete("/invitations/{invitationID}", shoppinglistHandler.RevokeInvitation)
+					r.Post("/transfer", shoppinglistHandler.TransferOwnership)
 
 					r.Route("/items", func(r chi.Router) {
 						r.Post("/", shoppinglistHandler.CreateItem)
 						r.Get("/", shoppinglistHandler.GetAllItemsByListID)
-						r.Patch("/{itemID}", shoppinglistHandler.UpdateItemStatus)
+						r.Patch("/{itemID}", shoppinglistHandler.UpdateItem)
+						r.Delete("/{itemID}", shoppinglistHandler.DeleteItem)
+						// Itens em texto livre: sugestões do catálogo e vínculo com um produto
+						r.Get("/{itemID}/suggestions", shoppinglistHandler.SuggestProducts)
+						r.Post("/{itemID}/link", shoppinglistHandler.LinkItem)
 					})
 				})
 			})
 
-			// --- Sub-grupo de Rotas SÓ PARA ADMINS ---
-			r.Group(func(r chi.Router) {
-				r.Use(middleware.AdminOnly) // Segurança extra
+			r.Route("/stores/{storeID}", func(r chi.Router) {
+				// Endereço, contato, horários e se a loja está aberta agora
+				r.Get("/", storeHandler.GetDetails)
+
+				// --- Sub-grupo de Rotas SÓ PARA ADMINS ---
+				r.Group(func(r chi.Router) {
+					r.Use(middleware.AdminOnly)  // Segurança extra
+					r.Use(middleware.StoreOwner) // Só a própria loja (ou super admin)
+
+					r.With(middleware.StoreStaffManager).Patch("/", storeHandler.Update)
+
+					r.Get("/products", stockItemHandler.GetAllByStoreId)
+					r.Post("/products/import", stockItemHandler.Import)
+					stockItemRoutes := func(r chi.Router) {
+						r.Post("/", stockItemHandler.Create)
+						r.Put("/", stockItemHandler.Upsert)
+						r.Patch("/", stockItemHandler.PartialUpdate)
+						r.Delete("/", stockItemHandler.Delete)
+					}
+					r.Route("/products/{productID}", stockItemRoutes)
+					r.Route("/products/barcode/{barcode}", stockItemRoutes)
 
-				r.Get("/stores/{storeID}/products", stockItemHandler.GetAllByStoreId)
-				r.Post("/stores/{storeID}/products/{productID}", stockItemHandler.Create)
+					// Equipe da loja: só administradores, não o repositor
+					r.Route("/staff", func(r chi.Router) {
+						r.Use(middleware.StoreStaffManager)
+
+						r.Get("/", storeHandler.ListStaff)
+						r.Delete("/{userID}", storeHandler.RemoveStaff)
+						r.Get("/invitations", storeHandler.ListInvitations)
+						r.Post("/invitations", storeHandler.Invite)
+						r.Delete("/invitations/{invitationID}", storeHandler.RevokeInvitation)
+					})
+				})
 			})
 
 			// --- Sub-grupo de Rotas SÓ PARA SUPER ADMINS ---
@@ -118,12 +235,77 @@ func main() {
 				r.Get("/categories/{id}", categoryHandler.GetByID)
 				r.Patch("/categories/{id}", categoryHandler.PartialUpdate) // Assumindo que criaremos este handler
 				r.Delete("/categories/{id}", categoryHandler.Delete)
+
+				// Aprovação de lojas novas, rejeição e suspensão
+				r.Route("/admin/stores", func(r chi.Router) {
+					r.Get("/", storeHandler.ListForReview)
+					r.Route("/{storeID}", func(r chi.Router) {
+						r.Get("/", storeHandler.GetForReview)
+						r.Post("/approve", storeHandler.Approve)
+						r.Post("/reject", storeHandler.Reject)
+						r.Post("/suspend", storeHandler.Suspend)
+					})
+				})
+
+				// Gestão de usuários, cargos e vínculo com lojas
+				r.Route("/admin/users", func(r chi.Router) {
+					r.Get("/", userHandler.ListUsers)
+					r.Route("/{userID}", func(r chi.Router) {
+						r.Put("/role", userHandler.ChangeRole)
+						r.Put("/store", userHandler.AttachStore)
+						r.Delete("/store", userHandler.DetachStore)
+						r.Get("/role-changes", userHandler.GetRoleChanges)
+					})
+				})
 			})
 		})
 	})
 
-	log.Println("Iniciando API na porta 8080...")
-	if err := http.ListenAndServe(":8080", r); err != nil {
-		log.Fatal("Erro ao iniciar o servidor: ", err)
+	server := &http.Server{
+		Addr:              cfg.Addr(),
+		Handler:           r,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
 	}
+	// Os streams de eventos não terminam sozinhos; fechar o broker encerra
+	// todos para o Shutdown não ficar esperando por eles
+	server.RegisterOnShutdown(listEvents.Close)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Printf("Iniciando API na porta %d (%s)...", cfg.Port, cfg.Env)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			db.Close()
+			log.Fatal("Erro ao iniciar o servidor: ", err)
+		}
+		return
+	case <-ctx.Done():
+	}
+	// Um segundo sinal encerra na hora
+	stop()
+
+	log.Println("Sinal recebido, desligando o servidor...")
+	healthHandler.SetDraining()
+	time.Sleep(cfg.ShutdownDrainDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	// Para de aceitar conexões e espera as requisições em andamento terminarem
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Requisições não terminaram a tempo: %v", err)
+	}
+
+	log.Println("Servidor desligado; fechando o pool do banco.")
+	db.Close()
 }
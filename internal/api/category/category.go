@@ -3,6 +3,7 @@ package category
 import (
 	"context"
 	"errors"
+	"localiza-compra/backend/internal/api/pagination"
 )
 
 var ErrCategoryNotFound = errors.New("categoria não encontrada")
@@ -25,7 +26,7 @@ type UpdateCategoryRequest struct {
 
 type Repository interface {
 	Create(ctx context.Context, category Category) (Category, error)
-	GetAll(ctx context.Context) ([]Category, error)
+	GetAll(ctx context.Context, params pagination.Params) ([]Category, int, error)
 	GetByID(ctx context.Context, id int64) (Category, error)
 	PartialUpdate(ctx context.Context, id int64, req UpdateCategoryRequest) error
 	Delete(ctx context.Context, id int64) error
@@ -33,7 +34,7 @@ type Repository interface {
 
 type Service interface {
 	Create(ctx context.Context, category Category) (Category, error)
-	GetAll(ctx context.Context) ([]Category, error)
+	GetAll(ctx context.Context, params pagination.Params) (pagination.Page[Category], error)
 	GetByID(ctx context.Context, id int64) (Category, error)
 	PartialUpdate(ctx context.Context, id int64, req UpdateCategoryRequest) error
 	Delete(ctx context.Context, id int64) error
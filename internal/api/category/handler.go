@@ -3,6 +3,7 @@ package category
 import (
 	"encoding/json"
 	"errors"
+	"localiza-compra/backend/internal/api/pagination"
 	"log"
 	"net/http"
 	"strconv"
@@ -113,14 +114,36 @@ func (h *categoryHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// listOptions define a ordenação e os filtros aceitos em GET /categories
+var listOptions = pagination.Options{
+	Sorts: map[string]string{
+		"name": "name",
+		"id":   "id",
+	},
+	DefaultSort: "name",
+	Tiebreaker:  "id",
+	Filters: map[string]pagination.Filter{
+		"name":      {Column: "name", Kind: pagination.FilterContains},
+		"parent_id": {Column: "parent_id", Kind: pagination.FilterInt},
+	},
+}
+
 func (h *categoryHandler) GetAll(w http.ResponseWriter, r *http.Request) {
-	categories, err := h.service.GetAll(r.Context())
+	params, err := pagination.Parse(r, listOptions)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	categories, err := h.service.GetAll(r.Context(), params)
 	if err != nil {
 		log.Printf("Erro ao buscar categorias: %v", err)
 		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
 		return
 	}
 
+	categories.SetLinks(w, r)
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(categories)
@@ -3,6 +3,7 @@ package category
 import (
 	"context"
 	"errors"
+	"localiza-compra/backend/internal/api/pagination"
 
 	sq "github.com/Masterminds/squirrel"
 	"github.com/jackc/pgx/v5"
@@ -89,32 +90,42 @@ func (r *pgxRepository) Delete(ctx context.Context, id int64) error {
 	return nil
 }
 
-func (r *pgxRepository) GetAll(ctx context.Context) ([]Category, error) {
-	query := `SELECT id, name, parent_id FROM categories`
+func (r *pgxRepository) GetAll(ctx context.Context, params pagination.Params) ([]Category, int, error) {
+	base := sq.Select().From("categories").PlaceholderFormat(sq.Dollar)
 
-	rows, err := r.db.Query(ctx, query)
+	total, err := pagination.Count(ctx, r.db, params.Filter(base.Columns("COUNT(*)")))
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+
+	query, args, err := params.Apply(base.Columns("id", "name", "parent_id")).ToSql()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
 	}
 
 	defer rows.Close()
 
-	var categories []Category
+	categories := make([]Category, 0)
 
 	for rows.Next() {
 		var c Category
 
 		err := rows.Scan(&c.ID, &c.Name, &c.ParentID)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 
 		categories = append(categories, c)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	return categories, nil
+	return categories, total, nil
 }
@@ -3,6 +3,7 @@ package category
 import (
 	"context"
 	"errors"
+	"localiza-compra/backend/internal/api/pagination"
 )
 
 type categoryService struct {
@@ -47,6 +48,10 @@ func (s *categoryService) Delete(ctx context.Context, id int64) error {
 	return s.repo.Delete(ctx, id)
 }
 
-func (s *categoryService) GetAll(ctx context.Context) ([]Category, error) {
-	return s.repo.GetAll(ctx)
+func (s *categoryService) GetAll(ctx context.Context, params pagination.Params) (pagination.Page[Category], error) {
+	categories, total, err := s.repo.GetAll(ctx, params)
+	if err != nil {
+		return pagination.Page[Category]{}, err
+	}
+	return pagination.NewPage(categories, total, params), nil
 }
@@ -0,0 +1,90 @@
+package cnpj
+
+import (
+	"errors"
+	"strings"
+)
+
+// Length é o tamanho do CNPJ sem máscara: 12 posições de identificação e 2
+// dígitos verificadores.
+const Length = 14
+
+var (
+	ErrEmpty              = errors.New("o CNPJ não pode ser vazio")
+	ErrInvalidLength      = errors.New("o CNPJ precisa ter 14 caracteres")
+	ErrInvalidCharacters  = errors.New("o CNPJ só pode ter letras e números nas 12 primeiras posições e números nos dígitos verificadores")
+	ErrInvalidCheckDigits = errors.New("os dígitos verificadores do CNPJ não conferem")
+)
+
+// Normalize remove a máscara (pontos, barra, hífen e espaços), passa as letras
+// para maiúsculas e valida o resultado. Aceita tanto o CNPJ numérico quanto o
+// alfanumérico da Receita Federal, em que as 12 primeiras posições podem ter
+// letras.
+func Normalize(s string) (string, error) {
+	var b strings.Builder
+	for _, c := range strings.ToUpper(s) {
+		switch c {
+		case '.', '/', '-', ' ':
+			continue
+		}
+		b.WriteRune(c)
+	}
+
+	cnpj := b.String()
+	if err := Validate(cnpj); err != nil {
+		return "", err
+	}
+	return cnpj, nil
+}
+
+// Validate confere um CNPJ já sem máscara.
+func Validate(cnpj string) error {
+	if cnpj == "" {
+		return ErrEmpty
+	}
+	if len(cnpj) != Length {
+		return ErrInvalidLength
+	}
+
+	for i := 0; i < Length; i++ {
+		c := cnpj[i]
+		isDigit := c >= '0' && c <= '9'
+		isLetter := c >= 'A' && c <= 'Z'
+		if !isDigit && !(isLetter && i < Length-2) {
+			return ErrInvalidCharacters
+		}
+	}
+
+	// Sequências repetidas passam no cálculo, mas não são CNPJs válidos
+	if strings.Count(cnpj, cnpj[:1]) == Length {
+		return ErrInvalidCheckDigits
+	}
+
+	first := checkDigit(cnpj[:12])
+	second := checkDigit(cnpj[:12] + string(first))
+	if cnpj[12] != first || cnpj[13] != second {
+		return ErrInvalidCheckDigits
+	}
+
+	return nil
+}
+
+// checkDigit calcula o módulo 11 com pesos de 2 a 9, da direita para a
+// esquerda. Cada caractere vale seu código ASCII menos 48, o que mantém os
+// números com o valor de sempre e dá às letras os valores de 17 (A) a 42 (Z).
+func checkDigit(base string) byte {
+	sum, weight := 0, 2
+	for i := len(base) - 1; i >= 0; i-- {
+		sum += int(base[i]-'0') * weight
+		weight++
+		if weight > 9 {
+			weight = 2
+		}
+	}
+
+	rest := sum % 11
+	if rest < 2 {
+		return '0'
+	}
+	return byte('0' + 11 - rest)
+}
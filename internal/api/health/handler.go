@@ -0,0 +1,91 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const pingTimeout = 2 * time.Second
+
+type PoolStats struct {
+	TotalConns    int32 `json:"total_conns"`
+	IdleConns     int32 `json:"idle_conns"`
+	AcquiredConns int32 `json:"acquired_conns"`
+	MaxConns      int32 `json:"max_conns"`
+	AcquireCount  int64 `json:"acquire_count"`
+	// Tempo total esperando conexão livre; cresce quando o pool está pequeno
+	AcquireWaitMs int64 `json:"empty_acquire_wait_ms"`
+}
+
+type ReadinessResponse struct {
+	Status   string     `json:"status"`
+	Database string     `json:"database"`
+	Pool     *PoolStats `json:"pool,omitempty"`
+}
+
+type healthHandler struct {
+	db       *pgxpool.Pool
+	draining atomic.Bool
+}
+
+func NewHandler(db *pgxpool.Pool) *healthHandler {
+	return &healthHandler{
+		db: db,
+	}
+}
+
+// SetDraining marca o servidor como em desligamento: a partir daí a prontidão
+// responde 503 para o balanceador parar de mandar tráfego.
+func (h *healthHandler) SetDraining() {
+	h.draining.Store(true)
+}
+
+// Live só diz que o processo está de pé; não depende do banco para o
+// orquestrador não reiniciar a API por causa de uma queda do Postgres.
+func (h *healthHandler) Live(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// Ready confere se a API pode receber tráfego: banco respondendo e servidor
+// fora do desligamento.
+func (h *healthHandler) Ready(w http.ResponseWriter, r *http.Request) {
+	resp := ReadinessResponse{Status: "ok", Database: "connected"}
+	status := http.StatusOK
+
+	stat := h.db.Stat()
+	resp.Pool = &PoolStats{
+		TotalConns:    stat.TotalConns(),
+		IdleConns:     stat.IdleConns(),
+		AcquiredConns: stat.AcquiredConns(),
+		MaxConns:      stat.MaxConns(),
+		AcquireCount:  stat.AcquireCount(),
+		AcquireWaitMs: stat.EmptyAcquireWaitTime().Milliseconds(),
+	}
+
+	if h.draining.Load() {
+		resp.Status = "draining"
+		status = http.StatusServiceUnavailable
+	} else {
+		ctx, cancel := context.WithTimeout(r.Context(), pingTimeout)
+		defer cancel()
+
+		if err := h.db.Ping(ctx); err != nil {
+			resp.Status = "unavailable"
+			resp.Database = "unreachable"
+			log.Printf("Prontidão: ping para o banco falhou: %v", err)
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
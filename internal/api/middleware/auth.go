@@ -2,8 +2,12 @@ package middleware
 
 import (
 	"context"
+	"localiza-compra/backend/internal/api/role"
+	"log"
 	"net/http"
+	"strconv"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/golang-jwt/jwt"
 )
 
@@ -11,56 +15,120 @@ type contextKey string
 
 const UserIDKey contextKey = "userID"
 const UserRoleKey contextKey = "userRole"
+const UserStoreIDKey contextKey = "userStoreID"
+const SessionIDKey contextKey = "sessionID"
 
-var jwtSecret = []byte("sua-chave-super-secreta")
-
-func Auth(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		cookie, err := r.Cookie("token")
-		if err != nil {
-			http.Error(w, "Não autorizado: token não encontrado", http.StatusUnauthorized)
-			return
-		}
-
-		tokenString := cookie.Value
+// SessionChecker diz se a sessão de um token ainda vale (não foi revogada no
+// logout nem expirou).
+type SessionChecker interface {
+	IsSessionActive(ctx context.Context, sessionID int64) (bool, error)
+}
 
-		claims := &jwt.MapClaims{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return jwtSecret, nil
+// Auth valida o JWT do cookie "token" com o segredo da configuração, confere
+// se a sessão continua ativa e coloca usuário, sessão, cargo e loja no contexto.
+func Auth(jwtSecret []byte, sessions SessionChecker) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cookie, err := r.Cookie("token")
+			if err != nil {
+				http.Error(w, "Não autorizado: token não encontrado", http.StatusUnauthorized)
+				return
+			}
+
+			tokenString := cookie.Value
+
+			claims := &jwt.MapClaims{}
+			token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+				return jwtSecret, nil
+			})
+
+			if err != nil || !token.Valid {
+				http.Error(w, "Token inválido", http.StatusUnauthorized)
+				return
+			}
+
+			userIDFloat, ok := (*claims)["sub"].(float64)
+			if !ok {
+				http.Error(w, "ID do usuário não encontrado no token", http.StatusUnauthorized)
+				return
+			}
+
+			roleClaim, ok := (*claims)["role"].(string)
+			userRole := role.Role(roleClaim)
+			if !ok || !userRole.Valid() {
+				http.Error(w, "Cargo do utilizador não encontrado no token", http.StatusUnauthorized)
+				return
+			}
+
+			// Tokens sem sessão vêm de antes dos refresh tokens e não podem ser revogados
+			sessionIDFloat, ok := (*claims)["sid"].(float64)
+			if !ok {
+				http.Error(w, "Token inválido", http.StatusUnauthorized)
+				return
+			}
+			sessionID := int64(sessionIDFloat)
+
+			active, err := sessions.IsSessionActive(r.Context(), sessionID)
+			if err != nil {
+				log.Printf("Erro ao verificar a sessão %d: %v", sessionID, err)
+				http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+				return
+			}
+			if !active {
+				http.Error(w, "Sessão encerrada", http.StatusUnauthorized)
+				return
+			}
+
+			userID := int64(userIDFloat)
+
+			ctx := context.WithValue(r.Context(), UserIDKey, userID)
+			ctx = context.WithValue(ctx, SessionIDKey, sessionID)
+			ctx = context.WithValue(ctx, UserRoleKey, userRole)
+
+			// store_id só existe para quem administra uma loja
+			if storeIDFloat, ok := (*claims)["store_id"].(float64); ok {
+				ctx = context.WithValue(ctx, UserStoreIDKey, int64(storeIDFloat))
+			}
+
+			next.ServeHTTP(w, r.WithContext(ctx))
 		})
+	}
+}
 
-		if err != nil || !token.Valid {
-			http.Error(w, "Token inválido", http.StatusUnauthorized)
-			return
-		}
+func AdminOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userRole, ok := r.Context().Value(UserRoleKey).(role.Role)
 
-		userIDFloat, ok := (*claims)["sub"].(float64)
-		if !ok {
-			http.Error(w, "ID do usuário não encontrado no token", http.StatusUnauthorized)
+		if !ok || !userRole.CanManageStock() {
+			http.Error(w, "Acesso negado: rota apenas para administradores", http.StatusForbidden)
 			return
 		}
 
-		userRole, ok := (*claims)["role"].(string)
-		if !ok {
-			http.Error(w, "Cargo do utilizador não encontrado no token", http.StatusUnauthorized)
-			return
-		}
+		next.ServeHTTP(w, r)
+	})
+}
 
-		userID := int64(userIDFloat)
+// StoreStaffManager libera só quem administra a equipe da loja; o repositor
+// (stock_clerk) mexe no estoque mas não convida nem remove colegas.
+func StoreStaffManager(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userRole, ok := r.Context().Value(UserRoleKey).(role.Role)
 
-		ctx := context.WithValue(r.Context(), UserIDKey, userID)
-		ctx = context.WithValue(ctx, UserRoleKey, userRole)
+		if !ok || !userRole.CanManageStaff() {
+			http.Error(w, "Acesso negado: rota apenas para administradores da loja", http.StatusForbidden)
+			return
+		}
 
-		next.ServeHTTP(w, r.WithContext(ctx))
+		next.ServeHTTP(w, r)
 	})
 }
 
-func AdminOnly(next http.Handler) http.Handler {
+func SuperAdminOnly(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		role, ok := r.Context().Value(UserRoleKey).(string)
+		userRole, ok := r.Context().Value(UserRoleKey).(role.Role)
 
-		if !ok || (role != "admin" && role != "store_admin") {
-			http.Error(w, "Acesso negado: rota apenas para administradores", http.StatusForbidden)
+		if !ok || userRole != role.SuperAdmin {
+			http.Error(w, "Acesso negado: rota apenas para super administradores", http.StatusForbidden)
 			return
 		}
 
@@ -68,12 +136,25 @@ func AdminOnly(next http.Handler) http.Handler {
 	})
 }
 
-func SuperAdminOnly(next http.Handler) http.Handler {
+// StoreOwner garante que o administrador só mexe na loja do {storeID} da rota
+// à qual está vinculado. Super admins têm acesso a todas as lojas.
+func StoreOwner(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		role, ok := r.Context().Value(UserRoleKey).(string)
+		userRole, _ := r.Context().Value(UserRoleKey).(role.Role)
+		if userRole == role.SuperAdmin {
+			next.ServeHTTP(w, r)
+			return
+		}
 
-		if !ok || (role != "super_admin") {
-			http.Error(w, "Acesso negado: rota apenas para super administradores", http.StatusForbidden)
+		storeID, err := strconv.ParseInt(chi.URLParam(r, "storeID"), 10, 64)
+		if err != nil {
+			http.Error(w, "ID da loja inválido", http.StatusBadRequest)
+			return
+		}
+
+		userStoreID, ok := r.Context().Value(UserStoreIDKey).(int64)
+		if !ok || userStoreID != storeID {
+			http.Error(w, "Acesso negado: você não administra esta loja", http.StatusForbidden)
 			return
 		}
 
@@ -0,0 +1,233 @@
+package pagination
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	DefaultLimit = 50
+	MaxLimit     = 200
+)
+
+var ErrInvalidParams = errors.New("parâmetros de listagem inválidos")
+
+type FilterKind int
+
+const (
+	// FilterText compara o texto exato
+	FilterText FilterKind = iota
+	// FilterInt compara um número inteiro
+	FilterInt
+	// FilterBool compara true/false
+	FilterBool
+	// FilterContains procura o texto em qualquer parte, sem diferenciar maiúsculas
+	FilterContains
+)
+
+// Filter liga um parâmetro da query string a uma coluna da consulta.
+type Filter struct {
+	Column string
+	Kind   FilterKind
+}
+
+// Options descreve o que cada endpoint de listagem aceita. Sorts e Filters
+// mapeiam o nome público do campo para a coluna no SQL.
+type Options struct {
+	Sorts       map[string]string
+	DefaultSort string // ex.: "name" ou "-created_at"
+	Tiebreaker  string // coluna única que garante uma ordem estável entre páginas
+	Filters     map[string]Filter
+}
+
+// Params é o resultado da leitura de ?limit=, ?offset=, ?sort= e dos filtros.
+type Params struct {
+	Limit   int
+	Offset  int
+	OrderBy []string
+	Where   []sq.Sqlizer
+}
+
+type Page[T any] struct {
+	Items  []T    `json:"items"`
+	Total  int    `json:"total"`
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
+	Next   string `json:"next,omitempty"`
+}
+
+// Querier é o pedaço do pgxpool/pgx.Tx usado para contar os registros.
+type Querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// Parse lê os parâmetros de listagem da requisição. sort aceita um campo ou
+// vários separados por vírgula; o prefixo "-" inverte a ordem.
+func Parse(r *http.Request, opts Options) (Params, error) {
+	query := r.URL.Query()
+	params := Params{Limit: DefaultLimit}
+
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return Params{}, fmt.Errorf("%w: limit precisa ser um número maior que zero", ErrInvalidParams)
+		}
+		params.Limit = min(limit, MaxLimit)
+	}
+
+	if v := query.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return Params{}, fmt.Errorf("%w: offset precisa ser um número não negativo", ErrInvalidParams)
+		}
+		params.Offset = offset
+	}
+
+	sort := query.Get("sort")
+	if sort == "" {
+		sort = opts.DefaultSort
+	}
+	for _, field := range strings.Split(sort, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		direction := "ASC"
+		if strings.HasPrefix(field, "-") {
+			direction = "DESC"
+			field = field[1:]
+		}
+
+		column, ok := opts.Sorts[field]
+		if !ok {
+			return Params{}, fmt.Errorf("%w: não é possível ordenar por %q", ErrInvalidParams, field)
+		}
+		params.OrderBy = append(params.OrderBy, column+" "+direction)
+	}
+	if opts.Tiebreaker != "" {
+		params.OrderBy = append(params.OrderBy, opts.Tiebreaker+" ASC")
+	}
+
+	// Ordem fixa dos filtros para gerar sempre o mesmo SQL
+	names := make([]string, 0, len(opts.Filters))
+	for name := range opts.Filters {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		filter := opts.Filters[name]
+		v := query.Get(name)
+		if v == "" {
+			continue
+		}
+
+		switch filter.Kind {
+		case FilterInt:
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return Params{}, fmt.Errorf("%w: %s precisa ser um número", ErrInvalidParams, name)
+			}
+			params.Where = append(params.Where, sq.Eq{filter.Column: n})
+		case FilterBool:
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return Params{}, fmt.Errorf("%w: %s precisa ser true ou false", ErrInvalidParams, name)
+			}
+			params.Where = append(params.Where, sq.Eq{filter.Column: b})
+		case FilterContains:
+			params.Where = append(params.Where, sq.ILike{filter.Column: "%" + escapeLike(v) + "%"})
+		default:
+			params.Where = append(params.Where, sq.Eq{filter.Column: v})
+		}
+	}
+
+	return params, nil
+}
+
+// likeEscaper protege os curingas do LIKE, para que % e _ digitados sejam
+// procurados como texto. A barra invertida é o escape padrão do Postgres.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+// Filter aplica só os filtros, para ser usado também na consulta de contagem.
+func (p Params) Filter(b sq.SelectBuilder) sq.SelectBuilder {
+	for _, where := range p.Where {
+		b = b.Where(where)
+	}
+	return b
+}
+
+// Apply aplica filtros, ordenação, limit e offset.
+func (p Params) Apply(b sq.SelectBuilder) sq.SelectBuilder {
+	b = p.Filter(b)
+	if len(p.OrderBy) > 0 {
+		b = b.OrderBy(p.OrderBy...)
+	}
+	return b.Limit(uint64(p.Limit)).Offset(uint64(p.Offset))
+}
+
+// Count executa a consulta de contagem (um SELECT COUNT(*) já filtrado).
+func Count(ctx context.Context, db Querier, b sq.SelectBuilder) (int, error) {
+	sql, args, err := b.ToSql()
+	if err != nil {
+		return 0, err
+	}
+
+	var total int
+	err = db.QueryRow(ctx, sql, args...).Scan(&total)
+	return total, err
+}
+
+func NewPage[T any](items []T, total int, p Params) Page[T] {
+	if items == nil {
+		items = make([]T, 0)
+	}
+	return Page[T]{
+		Items:  items,
+		Total:  total,
+		Limit:  p.Limit,
+		Offset: p.Offset,
+	}
+}
+
+// SetLinks preenche Next e escreve o cabeçalho Link (rel="next" e rel="prev")
+// com a mesma URL da requisição, trocando apenas o offset.
+func (p *Page[T]) SetLinks(w http.ResponseWriter, r *http.Request) {
+	links := make([]string, 0, 2)
+
+	if p.Offset+p.Limit < p.Total {
+		p.Next = pageURL(r.URL, p.Offset+p.Limit, p.Limit)
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, p.Next))
+	}
+	if p.Offset > 0 {
+		prev := max(p.Offset-p.Limit, 0)
+		links = append(links, fmt.Sprintf(`<%s>; rel="prev"`, pageURL(r.URL, prev, p.Limit)))
+	}
+
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+}
+
+func pageURL(u *url.URL, offset, limit int) string {
+	query := u.Query()
+	query.Set("offset", strconv.Itoa(offset))
+	query.Set("limit", strconv.Itoa(limit))
+
+	next := url.URL{Path: u.Path, RawQuery: query.Encode()}
+	return next.String()
+}
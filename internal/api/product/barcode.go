@@ -0,0 +1,75 @@
+package product
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+var ErrInvalidBarcode = errors.New("código de barras inválido")
+
+// NormalizeBarcode remove espaços e hífens e valida o código como EAN-8, UPC-A
+// (12 dígitos) ou EAN-13, incluindo o dígito verificador. UPC-A é guardado como
+// EAN-13 com zero à esquerda, para que o mesmo produto não entre duas vezes.
+func NormalizeBarcode(code string) (string, error) {
+	code = strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(code))
+
+	switch len(code) {
+	case 8, 12, 13:
+	default:
+		return "", ErrInvalidBarcode
+	}
+
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return "", ErrInvalidBarcode
+		}
+	}
+
+	if !validCheckDigit(code) {
+		return "", ErrInvalidBarcode
+	}
+
+	if len(code) == 12 {
+		code = "0" + code
+	}
+
+	return code, nil
+}
+
+// validCheckDigit aplica o módulo 10 do GS1: da direita para a esquerda, sem
+// contar o verificador, os dígitos têm peso 3 e 1 alternadamente.
+func validCheckDigit(code string) bool {
+	sum := 0
+	weight := 3
+	for i := len(code) - 2; i >= 0; i-- {
+		sum += int(code[i]-'0') * weight
+		weight = 4 - weight
+	}
+
+	check := (10 - sum%10) % 10
+	return check == int(code[len(code)-1]-'0')
+}
+
+// ResolveID devolve o ID do produto informado diretamente ou pelo código de
+// barras. É usado onde a API aceita qualquer um dos dois.
+func ResolveID(ctx context.Context, repo Repository, productID int64, barcode string) (int64, error) {
+	if productID != 0 {
+		return productID, nil
+	}
+	if barcode == "" {
+		return 0, ErrProductNotFound
+	}
+
+	normalized, err := NormalizeBarcode(barcode)
+	if err != nil {
+		return 0, err
+	}
+
+	p, err := repo.GetByBarcode(ctx, normalized)
+	if err != nil {
+		return 0, err
+	}
+
+	return p.ID, nil
+}
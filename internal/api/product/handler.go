@@ -3,6 +3,7 @@ package product
 import (
 	"encoding/json"
 	"errors"
+	"localiza-compra/backend/internal/api/pagination"
 	"log"
 	"net/http"
 	"strconv"
@@ -20,14 +21,38 @@ func NewHandler(s Service) *productHandler {
 	}
 }
 
+// listOptions define a ordenação e os filtros aceitos em GET /products
+var listOptions = pagination.Options{
+	Sorts: map[string]string{
+		"name":       "name",
+		"brand":      "brand",
+		"created_at": "created_at",
+	},
+	DefaultSort: "name",
+	Tiebreaker:  "id",
+	Filters: map[string]pagination.Filter{
+		"name":        {Column: "name", Kind: pagination.FilterContains},
+		"brand":       {Column: "brand", Kind: pagination.FilterText},
+		"category_id": {Column: "category_id", Kind: pagination.FilterInt},
+	},
+}
+
 func (h *productHandler) GetAll(w http.ResponseWriter, r *http.Request) {
-	products, err := h.service.GetAll(r.Context())
+	params, err := pagination.Parse(r, listOptions)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	products, err := h.service.GetAll(r.Context(), params)
 	if err != nil {
 		log.Printf("Erro ao buscar produtos: %v", err)
 		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
 		return
 	}
 
+	products.SetLinks(w, r)
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(products)
@@ -44,6 +69,14 @@ func (h *productHandler) Create(w http.ResponseWriter, r *http.Request) {
 
 	createdProduct, err := h.service.Create(r.Context(), product)
 	if err != nil {
+		if errors.Is(err, ErrInvalidBarcode) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, ErrBarcodeAlreadyExists) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
 		log.Printf("Erro ao criar produto: %v", err)
 		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
 		return
@@ -76,6 +109,14 @@ func (h *productHandler) Update(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, err.Error(), http.StatusNotFound)
 			return
 		}
+		if errors.Is(err, ErrInvalidBarcode) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, ErrBarcodeAlreadyExists) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
 		log.Printf("Erro ao atualizar produto: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -100,6 +141,10 @@ func (h *productHandler) Delete(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, err.Error(), http.StatusNotFound)
 			return
 		}
+		if errors.Is(err, ErrProductInUse) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
 		log.Printf("Erro ao deletar produto: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -108,19 +153,46 @@ func (h *productHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func (h *productHandler) SearchByName(w http.ResponseWriter, r *http.Request) {
-	searchTerm := r.URL.Query().Get("search")
+// Search aceita ?q= (ou ?search=), ?category=, ?brand=, ?limit= e ?offset=
+func (h *productHandler) Search(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
 
-	products, err := h.service.SearchByName(r.Context(), searchTerm)
+	page, err := pagination.Parse(r, pagination.Options{})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	params := SearchParams{
+		Term:  query.Get("q"),
+		Brand: query.Get("brand"),
+		Page:  page,
+	}
+	if params.Term == "" {
+		params.Term = query.Get("search")
+	}
+
+	if param := query.Get("category"); param != "" {
+		categoryID, err := strconv.ParseInt(param, 10, 64)
+		if err != nil {
+			http.Error(w, "ID da categoria inválido", http.StatusBadRequest)
+			return
+		}
+		params.CategoryID = &categoryID
+	}
+
+	result, err := h.service.Search(r.Context(), params)
 	if err != nil {
 		log.Printf("Erro ao buscar produtos: %v", err)
 		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
 		return
 	}
 
+	result.SetLinks(w, r)
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(products)
+	json.NewEncoder(w).Encode(result)
 }
 
 func (h *productHandler) PartialUpdate(w http.ResponseWriter, r *http.Request) {
@@ -142,9 +214,38 @@ func (h *productHandler) PartialUpdate(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, err.Error(), http.StatusNotFound)
 			return
 		}
+		if errors.Is(err, ErrInvalidBarcode) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, ErrBarcodeAlreadyExists) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
 		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+func (h *productHandler) GetByBarcode(w http.ResponseWriter, r *http.Request) {
+	product, err := h.service.GetByBarcode(r.Context(), chi.URLParam(r, "code"))
+	if err != nil {
+		if errors.Is(err, ErrInvalidBarcode) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, ErrProductNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		log.Printf("Erro ao buscar produto pelo código de barras: %v", err)
+		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(product)
+}
@@ -3,10 +3,13 @@ package product
 import (
 	"context"
 	"errors"
+	"localiza-compra/backend/internal/api/pagination"
 	"time"
 )
 
 var ErrProductNotFound = errors.New("produto não encontrado")
+var ErrBarcodeAlreadyExists = errors.New("o código de barras já está em uso por outro produto")
+var ErrProductInUse = errors.New("o produto ainda está no estoque de alguma loja ou em listas de compras")
 
 type Product struct {
 	ID          int64     `json:"id"`
@@ -16,6 +19,7 @@ type Product struct {
 	Brand       string    `json:"brand"`
 	ImageUrl    string    `json:"image_url"`
 	CategoryID  *int64    `json:"category_id,omitempty"`
+	Barcode     *string   `json:"barcode,omitempty"`
 }
 
 // UpdateProductRequest é o DTO para atualizações parciais (PATCH)
@@ -25,22 +29,26 @@ type UpdateProductRequest struct {
 	Brand       *string `json:"brand,omitempty"`
 	ImageUrl    *string `json:"image_url,omitempty"`
 	CategoryID  *int64  `json:"category_id,omitempty"`
+	Barcode     *string `json:"barcode,omitempty"`
 }
 
 type Service interface {
-	GetAll(ctx context.Context) ([]Product, error)
+	GetAll(ctx context.Context, params pagination.Params) (pagination.Page[Product], error)
 	Create(ctx context.Context, product Product) (Product, error)
 	Update(ctx context.Context, product Product) (Product, error)
 	Delete(ctx context.Context, id int64) error
-	SearchByName(ctx context.Context, name string) ([]Product, error)
+	Search(ctx context.Context, params SearchParams) (pagination.Page[SearchHit], error)
 	PartialUpdate(ctx context.Context, id int64, req UpdateProductRequest) error
+	GetByBarcode(ctx context.Context, barcode string) (Product, error)
 }
 
 type Repository interface {
-	GetAll(ctx context.Context) ([]Product, error)
+	GetAll(ctx context.Context, params pagination.Params) ([]Product, int, error)
 	Create(ctx context.Context, product Product) (Product, error)
 	Update(ctx context.Context, product Product) (Product, error)
 	Delete(ctx context.Context, id int64) error
-	SearchByName(ctx context.Context, name string) ([]Product, error)
+	Search(ctx context.Context, params SearchParams) ([]SearchHit, int, error)
+	Suggest(ctx context.Context, term string, limit int) ([]SearchHit, error)
 	PartialUpdate(ctx context.Context, id int64, req UpdateProductRequest) error
+	GetByBarcode(ctx context.Context, barcode string) (Product, error)
 }
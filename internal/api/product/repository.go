@@ -3,9 +3,11 @@ package product
 import (
 	"context"
 	"errors"
+	"localiza-compra/backend/internal/api/pagination"
 
 	sq "github.com/Masterminds/squirrel"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -21,14 +23,24 @@ func NewRepository(dbpool *pgxpool.Pool) Repository {
 	}
 }
 
-// GetAll busca todos os produtos no banco de dados.
-func (r *pgxProductRepository) GetAll(ctx context.Context) ([]Product, error) {
-	query := "SELECT id, name, description, created_at, brand, image_url, category_id FROM products"
+// GetAll busca uma página de produtos no banco de dados, junto com o total.
+func (r *pgxProductRepository) GetAll(ctx context.Context, params pagination.Params) ([]Product, int, error) {
+	base := sq.Select().From("products").PlaceholderFormat(sq.Dollar)
 
-	rows, err := r.db.Query(ctx, query)
+	total, err := pagination.Count(ctx, r.db, params.Filter(base.Columns("COUNT(*)")))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query, args, err := params.Apply(base.Columns("id", "name", "description", "created_at", "brand", "image_url", "category_id", "barcode")).ToSql()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.Query(ctx, query, args...)
 
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	defer rows.Close()
@@ -38,19 +50,19 @@ func (r *pgxProductRepository) GetAll(ctx context.Context) ([]Product, error) {
 	for rows.Next() {
 		var p Product
 
-		err := rows.Scan(&p.ID, &p.Name, &p.Description, &p.CreatedAt, &p.Brand, &p.ImageUrl, &p.CategoryID)
+		err := rows.Scan(&p.ID, &p.Name, &p.Description, &p.CreatedAt, &p.Brand, &p.ImageUrl, &p.CategoryID, &p.Barcode)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 
 		products = append(products, p)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	return products, nil
+	return products, total, nil
 
 }
 
@@ -58,14 +70,17 @@ func (r *pgxProductRepository) GetAll(ctx context.Context) ([]Product, error) {
 func (r *pgxProductRepository) Create(ctx context.Context, product Product) (Product, error) {
 
 	query := `
-		INSERT INTO products (name, description, brand, image_url, category_id)
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO products (name, description, brand, image_url, category_id, barcode)
+		VALUES ($1, $2, $3, $4, $5, $6)
 		RETURNING id, created_at
 	`
 
-	err := r.db.QueryRow(ctx, query, product.Name, product.Description, product.Brand, product.ImageUrl, product.CategoryID).Scan(&product.ID, &product.CreatedAt)
+	err := r.db.QueryRow(ctx, query, product.Name, product.Description, product.Brand, product.ImageUrl, product.CategoryID, product.Barcode).Scan(&product.ID, &product.CreatedAt)
 
 	if err != nil {
+		if isUniqueViolation(err) {
+			return Product{}, ErrBarcodeAlreadyExists
+		}
 		return Product{}, err
 	}
 
@@ -76,9 +91,9 @@ func (r *pgxProductRepository) Create(ctx context.Context, product Product) (Pro
 func (r *pgxProductRepository) Update(ctx context.Context, product Product) (Product, error) {
 	query := `
 		UPDATE products
-		SET name = $1, description = $2, brand = $3, image_url = $4
-		WHERE id = $5
-		RETURNING id, name, description, created_at, brand, image_url
+		SET name = $1, description = $2, brand = $3, image_url = $4, barcode = $5
+		WHERE id = $6
+		RETURNING id, name, description, created_at, brand, image_url, barcode
 	`
 
 	var updatedProduct Product
@@ -87,6 +102,7 @@ func (r *pgxProductRepository) Update(ctx context.Context, product Product) (Pro
 		product.Description,
 		product.Brand,
 		product.ImageUrl,
+		product.Barcode,
 		product.ID,
 	).Scan(
 		&updatedProduct.ID,
@@ -95,24 +111,32 @@ func (r *pgxProductRepository) Update(ctx context.Context, product Product) (Pro
 		&updatedProduct.CreatedAt,
 		&updatedProduct.Brand,
 		&updatedProduct.ImageUrl,
+		&updatedProduct.Barcode,
 	)
 
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return Product{}, ErrProductNotFound
 		}
+		if isUniqueViolation(err) {
+			return Product{}, ErrBarcodeAlreadyExists
+		}
 		return Product{}, err
 	}
 
 	return product, nil
 }
 
-// Delete remove um produto do banco de dados pelo seu ID
+// Delete remove um produto do banco de dados pelo seu ID. O histórico de
+// preços vai junto; estoque e itens de lista impedem a remoção.
 func (r *pgxProductRepository) Delete(ctx context.Context, id int64) error {
 	query := `DELETE FROM products WHERE id = $1`
 
 	tag, err := r.db.Exec(ctx, query, id)
 	if err != nil {
+		if isForeignKeyViolation(err) {
+			return ErrProductInUse
+		}
 		return err
 	}
 
@@ -123,37 +147,6 @@ func (r *pgxProductRepository) Delete(ctx context.Context, id int64) error {
 	return nil
 }
 
-func (r *pgxProductRepository) SearchByName(ctx context.Context, name string) ([]Product, error) {
-	searchTerm := "%" + name + "%"
-
-	query := `SELECT id, name, description, created_at, brand, image_url FROM products WHERE name ILIKE $1`
-
-	rows, err := r.db.Query(ctx, query, searchTerm)
-	if err != nil {
-		return nil, err
-	}
-
-	defer rows.Close()
-
-	products := make([]Product, 0)
-
-	for rows.Next() {
-		var p Product
-
-		err := rows.Scan(&p.ID, &p.Name, &p.Description, &p.CreatedAt, &p.Brand, &p.ImageUrl)
-		if err != nil {
-			return nil, err
-		}
-		products = append(products, p)
-	}
-
-	if err = rows.Err(); err != nil {
-		return nil, err
-	}
-
-	return products, nil
-}
-
 func (r *pgxProductRepository) PartialUpdate(ctx context.Context, id int64, req UpdateProductRequest) error {
 	updateBuilder := sq.Update("products").
 		Where(sq.Eq{"id": id}).
@@ -173,6 +166,9 @@ func (r *pgxProductRepository) PartialUpdate(ctx context.Context, id int64, req
 	if req.CategoryID != nil {
 		updateBuilder = updateBuilder.Set("category_id", *req.CategoryID)
 	}
+	if req.Barcode != nil {
+		updateBuilder = updateBuilder.Set("barcode", *req.Barcode)
+	}
 
 	sql, args, err := updateBuilder.ToSql()
 	if err != nil {
@@ -181,6 +177,9 @@ func (r *pgxProductRepository) PartialUpdate(ctx context.Context, id int64, req
 
 	tag, err := r.db.Exec(ctx, sql, args...)
 	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrBarcodeAlreadyExists
+		}
 		return err
 	}
 
@@ -190,3 +189,30 @@ func (r *pgxProductRepository) PartialUpdate(ctx context.Context, id int64, req
 
 	return nil
 }
+
+// GetByBarcode busca um produto pelo código de barras já normalizado
+func (r *pgxProductRepository) GetByBarcode(ctx context.Context, barcode string) (Product, error) {
+	query := `SELECT id, name, description, created_at, brand, image_url, category_id, barcode FROM products WHERE barcode = $1`
+
+	var p Product
+
+	err := r.db.QueryRow(ctx, query, barcode).Scan(&p.ID, &p.Name, &p.Description, &p.CreatedAt, &p.Brand, &p.ImageUrl, &p.CategoryID, &p.Barcode)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Product{}, ErrProductNotFound
+		}
+		return Product{}, err
+	}
+
+	return p, nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+func isForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23503"
+}
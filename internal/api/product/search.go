@@ -0,0 +1,193 @@
+package product
+
+import (
+	"context"
+	"localiza-compra/backend/internal/api/pagination"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SearchParams são os filtros da busca de produtos. A ordem é sempre por
+// relevância, então de Page só valem limit e offset.
+type SearchParams struct {
+	Term       string
+	CategoryID *int64
+	Brand      string
+	Page       pagination.Params
+}
+
+type SearchHit struct {
+	Product
+	Rank float64 `json:"rank"`
+}
+
+// Nas sugestões, palavras mais curtas que isto viram prefixo de quase tudo
+const minSuggestWordLength = 3
+
+// buildTSQuery transforma o texto digitado numa tsquery em que todas as
+// palavras precisam aparecer, cada uma também como prefixo ("arro" acha
+// "arroz"). Pontuação é descartada para não quebrar a sintaxe do to_tsquery.
+func buildTSQuery(term string) string {
+	return strings.Join(tsPrefixes(searchWords(term)), " & ")
+}
+
+// buildSuggestTSQuery é como buildTSQuery, mas basta uma das palavras
+// aparecer: "algo para o churrasco" ainda acha "carvão para churrasco". As
+// palavras curtas ficam de fora, a não ser que não haja outras.
+func buildSuggestTSQuery(term string) string {
+	words := searchWords(term)
+
+	long := make([]string, 0, len(words))
+	for _, w := range words {
+		if utf8.RuneCountInString(w) >= minSuggestWordLength {
+			long = append(long, w)
+		}
+	}
+	if len(long) > 0 {
+		words = long
+	}
+
+	return strings.Join(tsPrefixes(words), " | ")
+}
+
+func searchWords(term string) []string {
+	return strings.FieldsFunc(term, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func tsPrefixes(words []string) []string {
+	parts := make([]string, 0, len(words))
+	for _, w := range words {
+		parts = append(parts, w+":*")
+	}
+	return parts
+}
+
+// Suggest busca os produtos que combinam com um texto livre, como o nome de um
+// item da lista de compras. Qualquer palavra serve, e os produtos que casam
+// com mais palavras vêm primeiro pelo ts_rank.
+func (r *pgxProductRepository) Suggest(ctx context.Context, term string, limit int) ([]SearchHit, error) {
+	tsQuery := buildSuggestTSQuery(term)
+	if tsQuery == "" {
+		return make([]SearchHit, 0), nil
+	}
+
+	query := `SELECT
+				p.id,
+				p.name,
+				p.description,
+				p.created_at,
+				p.brand,
+				p.image_url,
+				p.category_id,
+				p.barcode,
+				ts_rank(p.search_vector, q.query) AS rank
+			FROM products p, to_tsquery('portuguese_unaccent', $1) AS q(query)
+			WHERE p.search_vector @@ q.query
+			ORDER BY rank DESC, p.name
+			LIMIT $2`
+
+	rows, err := r.db.Query(ctx, query, tsQuery, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	hits := make([]SearchHit, 0)
+
+	for rows.Next() {
+		var h SearchHit
+
+		err := rows.Scan(&h.ID, &h.Name, &h.Description, &h.CreatedAt, &h.Brand, &h.ImageUrl, &h.CategoryID, &h.Barcode, &h.Rank)
+		if err != nil {
+			return nil, err
+		}
+
+		hits = append(hits, h)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return hits, nil
+}
+
+// Search faz a busca textual em nome, marca e descrição, com stemming em
+// português e sem diferenciar acentos. A categoria inclui as subcategorias.
+// Sem termo, lista os produtos que passam nos filtros.
+func (r *pgxProductRepository) Search(ctx context.Context, params SearchParams) ([]SearchHit, int, error) {
+	query := `WITH RECURSIVE category_tree AS (
+				SELECT id FROM categories WHERE id = $2
+				UNION ALL
+				SELECT c.id FROM categories c JOIN category_tree ct ON c.parent_id = ct.id
+			)
+			SELECT
+				p.id,
+				p.name,
+				p.description,
+				p.created_at,
+				p.brand,
+				p.image_url,
+				p.category_id,
+				p.barcode,
+				ts_rank(p.search_vector, q.query) AS rank,
+				COUNT(*) OVER () AS total
+			FROM products p, to_tsquery('portuguese_unaccent', $1) AS q(query)
+			WHERE ($1 = '' OR p.search_vector @@ q.query)
+				AND ($2::bigint IS NULL OR p.category_id IN (SELECT id FROM category_tree))
+				AND ($3 = '' OR unaccent(lower(p.brand)) = unaccent(lower($3)))
+			ORDER BY rank DESC, p.name
+			LIMIT $4 OFFSET $5`
+
+	offset := params.Page.Offset
+
+	rows, err := r.db.Query(ctx, query, buildTSQuery(params.Term), params.CategoryID, params.Brand, params.Page.Limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer rows.Close()
+
+	hits := make([]SearchHit, 0)
+	total := 0
+
+	for rows.Next() {
+		var h SearchHit
+
+		err := rows.Scan(&h.ID, &h.Name, &h.Description, &h.CreatedAt, &h.Brand, &h.ImageUrl, &h.CategoryID, &h.Barcode, &h.Rank, &total)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		hits = append(hits, h)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	// Página além do fim não traz linhas, então o total precisa de outra consulta
+	if len(hits) == 0 && offset > 0 {
+		countQuery := `WITH RECURSIVE category_tree AS (
+					SELECT id FROM categories WHERE id = $2
+					UNION ALL
+					SELECT c.id FROM categories c JOIN category_tree ct ON c.parent_id = ct.id
+				)
+				SELECT COUNT(*)
+				FROM products p
+				WHERE ($1 = '' OR p.search_vector @@ to_tsquery('portuguese_unaccent', $1))
+					AND ($2::bigint IS NULL OR p.category_id IN (SELECT id FROM category_tree))
+					AND ($3 = '' OR unaccent(lower(p.brand)) = unaccent(lower($3)))`
+
+		err = r.db.QueryRow(ctx, countQuery, buildTSQuery(params.Term), params.CategoryID, params.Brand).Scan(&total)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return hits, total, nil
+}
@@ -3,6 +3,8 @@ package product
 import (
 	"context"
 	"errors"
+	"localiza-compra/backend/internal/api/pagination"
+	"strings"
 )
 
 type productService struct {
@@ -15,14 +17,21 @@ func NewService(r Repository) Service {
 	}
 }
 
-func (s *productService) GetAll(ctx context.Context) ([]Product, error) {
-	return s.repo.GetAll(ctx)
+func (s *productService) GetAll(ctx context.Context, params pagination.Params) (pagination.Page[Product], error) {
+	products, total, err := s.repo.GetAll(ctx, params)
+	if err != nil {
+		return pagination.Page[Product]{}, err
+	}
+	return pagination.NewPage(products, total, params), nil
 }
 
 func (s *productService) Create(ctx context.Context, product Product) (Product, error) {
 	if product.Name == "" {
 		return Product{}, errors.New("o nome do produto não pode ser vazio")
 	}
+	if err := normalizeProductBarcode(&product.Barcode); err != nil {
+		return Product{}, err
+	}
 
 	return s.repo.Create(ctx, product)
 }
@@ -31,6 +40,9 @@ func (s *productService) Update(ctx context.Context, product Product) (Product,
 	if product.Name == "" {
 		return Product{}, errors.New("o nome do produto não pode ser vazio")
 	}
+	if err := normalizeProductBarcode(&product.Barcode); err != nil {
+		return Product{}, err
+	}
 
 	return s.repo.Update(ctx, product)
 }
@@ -39,10 +51,52 @@ func (s *productService) Delete(ctx context.Context, id int64) error {
 	return s.repo.Delete(ctx, id)
 }
 
-func (s *productService) SearchByName(ctx context.Context, name string) ([]Product, error) {
-	return s.repo.SearchByName(ctx, name)
+func (s *productService) Search(ctx context.Context, params SearchParams) (pagination.Page[SearchHit], error) {
+	params.Term = strings.TrimSpace(params.Term)
+	params.Brand = strings.TrimSpace(params.Brand)
+
+	hits, total, err := s.repo.Search(ctx, params)
+	if err != nil {
+		return pagination.Page[SearchHit]{}, err
+	}
+
+	return pagination.NewPage(hits, total, params.Page), nil
 }
 
 func (s *productService) PartialUpdate(ctx context.Context, id int64, req UpdateProductRequest) error {
+	if req.Barcode != nil {
+		barcode, err := NormalizeBarcode(*req.Barcode)
+		if err != nil {
+			return err
+		}
+		req.Barcode = &barcode
+	}
 	return s.repo.PartialUpdate(ctx, id, req)
 }
+
+func (s *productService) GetByBarcode(ctx context.Context, barcode string) (Product, error) {
+	barcode, err := NormalizeBarcode(barcode)
+	if err != nil {
+		return Product{}, err
+	}
+	return s.repo.GetByBarcode(ctx, barcode)
+}
+
+// normalizeProductBarcode valida o código de barras opcional do produto; um
+// código vazio é tratado como ausente.
+func normalizeProductBarcode(barcode **string) error {
+	if *barcode == nil {
+		return nil
+	}
+	if **barcode == "" {
+		*barcode = nil
+		return nil
+	}
+
+	normalized, err := NormalizeBarcode(**barcode)
+	if err != nil {
+		return err
+	}
+	*barcode = &normalized
+	return nil
+}
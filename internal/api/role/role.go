@@ -0,0 +1,64 @@
+package role
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Role é o cargo gravado em users.role e levado no token de acesso.
+type Role string
+
+const (
+	Customer   Role = "customer"
+	Admin      Role = "admin"
+	StoreAdmin Role = "store_admin"
+	StockClerk Role = "stock_clerk"
+	SuperAdmin Role = "super_admin"
+)
+
+var ErrInvalidRole = errors.New("cargo inválido")
+
+// All lista os cargos conhecidos, na ordem em que aparecem para o usuário.
+var All = []Role{Customer, Admin, StoreAdmin, StockClerk, SuperAdmin}
+
+// Parse aceita o nome do cargo sem diferenciar maiúsculas.
+func Parse(s string) (Role, error) {
+	r := Role(strings.ToLower(strings.TrimSpace(s)))
+	if !r.Valid() {
+		return "", fmt.Errorf("%w: %q (use %s)", ErrInvalidRole, s, names())
+	}
+	return r, nil
+}
+
+func (r Role) Valid() bool {
+	for _, known := range All {
+		if r == known {
+			return true
+		}
+	}
+	return false
+}
+
+// RequiresStore diz se o cargo só faz sentido vinculado a uma loja.
+func (r Role) RequiresStore() bool {
+	return r == StoreAdmin || r == StockClerk
+}
+
+// CanManageStock diz se o cargo tem acesso às rotas administrativas de loja.
+func (r Role) CanManageStock() bool {
+	return r == Admin || r == StoreAdmin || r == StockClerk || r == SuperAdmin
+}
+
+// CanManageStaff diz se o cargo pode convidar e remover a equipe da loja.
+func (r Role) CanManageStaff() bool {
+	return r == Admin || r == StoreAdmin || r == SuperAdmin
+}
+
+func names() string {
+	parts := make([]string, len(All))
+	for i, r := range All {
+		parts[i] = string(r)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,59 @@
+package securetoken
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+var ErrInvalid = errors.New("link inválido ou expirado")
+
+// NewRandom gera um token aleatório e o hash que vai para o banco.
+func NewRandom() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, Hash(token), nil
+}
+
+// NewSigned gera um valor aleatório assinado com HMAC junto com a finalidade,
+// então um token de uma finalidade não serve para outra e um token adulterado
+// é recusado antes de ir ao banco.
+func NewSigned(secret []byte, purpose string) (token, hash string, err error) {
+	value, _, err := NewRandom()
+	if err != nil {
+		return "", "", err
+	}
+	token = value + "." + sign(secret, purpose, value)
+	return token, Hash(token), nil
+}
+
+// VerifySigned confere a assinatura e devolve o hash usado na busca.
+func VerifySigned(secret []byte, purpose, token string) (string, error) {
+	value, signature, ok := strings.Cut(token, ".")
+	if !ok || value == "" {
+		return "", ErrInvalid
+	}
+	if !hmac.Equal([]byte(signature), []byte(sign(secret, purpose, value))) {
+		return "", ErrInvalid
+	}
+	return Hash(token), nil
+}
+
+// Hash é o que fica gravado no lugar do token.
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func sign(secret []byte, purpose, value string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(purpose + "." + value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,199 @@
+package shoppinglist
+
+import (
+	"sync"
+	"time"
+)
+
+// Tipos de evento enviados em GET /shopping-lists/{listID}/events
+const (
+	EventItemAdded           = "item_added"
+	EventItemRemoved         = "item_removed"
+	EventItemChecked         = "item_checked"
+	EventItemQuantityChanged = "item_quantity_changed"
+	EventItemLinked          = "item_linked"
+	EventItemNoteChanged     = "item_note_changed"
+	EventMemberRemoved       = "member_removed"
+	EventListDeleted         = "list_deleted"
+	// EventResync pede ao cliente para buscar a lista de novo: os eventos
+	// perdidos já saíram do histórico (ou o servidor reiniciou)
+	EventResync = "resync"
+)
+
+const (
+	// Quantos eventos por lista ficam guardados para retomar a conexão
+	eventHistorySize = 100
+	// Por quanto tempo o histórico de uma lista sem eventos novos é mantido
+	eventHistoryTTL = 15 * time.Minute
+	// Eventos na fila de um assinante; quem fica para trás é desconectado e
+	// retoma pelo Last-Event-ID
+	subscriberBuffer = 32
+)
+
+// Event é uma mudança numa lista. Item vem completo em item_added,
+// item_checked e item_quantity_changed; em item_removed, só com o ID.
+type Event struct {
+	ID      int64             `json:"id"`
+	Type    string            `json:"type"`
+	ListID  int64             `json:"list_id"`
+	ActorID int64             `json:"actor_id"`
+	Item    *ShoppingListItem `json:"item,omitempty"`
+	// UserID é o colaborador removido, em member_removed
+	UserID int64     `json:"user_id,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// Subscription é uma conexão aberta com os eventos de uma lista. Replay traz
+// os eventos perdidos desde o Last-Event-ID; Cancel precisa ser chamado ao
+// fechar a conexão.
+type Subscription struct {
+	Replay []Event
+	Resync bool
+	Events <-chan Event
+	Cancel func()
+}
+
+type listChannel struct {
+	history []Event
+	// floor é o último ID que não está no histórico: quem viu até floor (ou
+	// depois) consegue retomar sem perder nada
+	floor       int64
+	subscribers map[chan Event]struct{}
+	lastEvent   time.Time
+}
+
+// Broker distribui os eventos das listas entre as conexões abertas neste
+// processo. Com mais de uma instância da API, cada uma só vê os eventos que
+// passaram por ela.
+type Broker struct {
+	mu     sync.Mutex
+	lists  map[int64]*listChannel
+	seq    int64
+	closed bool
+}
+
+// NewBroker começa a numeração dos eventos no instante atual, para um
+// Last-Event-ID de antes de um reinício nunca coincidir com um evento novo.
+func NewBroker() *Broker {
+	return &Broker{
+		lists: make(map[int64]*listChannel),
+		seq:   time.Now().UnixMilli() * 1000,
+	}
+}
+
+// Publish numera o evento, guarda no histórico da lista e entrega a quem
+// está assinando.
+func (b *Broker) Publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+
+	b.seq++
+	e.ID = b.seq
+	e.At = time.Now()
+
+	ch := b.channel(e.ListID)
+	ch.history = append(ch.history, e)
+	if len(ch.history) > eventHistorySize {
+		dropped := len(ch.history) - eventHistorySize
+		ch.floor = ch.history[dropped-1].ID
+		ch.history = ch.history[dropped:]
+	}
+	ch.lastEvent = e.At
+
+	for sub := range ch.subscribers {
+		select {
+		case sub <- e:
+		default:
+			delete(ch.subscribers, sub)
+			close(sub)
+		}
+	}
+
+	b.prune(e.At)
+}
+
+// Subscribe abre uma assinatura da lista. Com lastEventID, Replay traz os
+// eventos que vieram depois dele, e Resync indica que parte deles já se perdeu.
+// O canal é fechado quando o assinante fica para trás ou o Broker é fechado.
+func (b *Broker) Subscribe(listID int64, lastEventID int64) Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub := make(chan Event, subscriberBuffer)
+	if b.closed {
+		close(sub)
+		return Subscription{Events: sub, Cancel: func() {}}
+	}
+
+	ch := b.channel(listID)
+	ch.subscribers[sub] = struct{}{}
+
+	var subscription Subscription
+	if lastEventID > 0 {
+		subscription.Replay, subscription.Resync = ch.since(lastEventID, b.seq)
+	}
+
+	subscription.Events = sub
+	subscription.Cancel = func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := ch.subscribers[sub]; ok {
+			delete(ch.subscribers, sub)
+			close(sub)
+		}
+	}
+
+	return subscription
+}
+
+// Close encerra todas as assinaturas; usado no desligamento do servidor.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for _, ch := range b.lists {
+		for sub := range ch.subscribers {
+			close(sub)
+		}
+		ch.subscribers = nil
+	}
+}
+
+func (b *Broker) channel(listID int64) *listChannel {
+	ch, ok := b.lists[listID]
+	if !ok {
+		ch = &listChannel{floor: b.seq, subscribers: make(map[chan Event]struct{}), lastEvent: time.Now()}
+		b.lists[listID] = ch
+	}
+	return ch
+}
+
+// since devolve os eventos depois de lastEventID. Um ID anterior ao histórico
+// (eventos descartados, histórico expirado ou outro processo) pede resync.
+func (ch *listChannel) since(lastEventID, currentSeq int64) ([]Event, bool) {
+	if lastEventID < ch.floor || lastEventID > currentSeq {
+		return nil, true
+	}
+
+	for i, e := range ch.history {
+		if e.ID > lastEventID {
+			return append([]Event(nil), ch.history[i:]...), false
+		}
+	}
+
+	return nil, false
+}
+
+// prune descarta o histórico das listas sem assinantes e sem eventos recentes.
+func (b *Broker) prune(now time.Time) {
+	for id, ch := range b.lists {
+		if len(ch.subscribers) == 0 && now.Sub(ch.lastEvent) > eventHistoryTTL {
+			delete(b.lists, id)
+		}
+	}
+}
@@ -3,10 +3,16 @@ package shoppinglist
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"localiza-compra/backend/internal/api/middleware"
+	"localiza-compra/backend/internal/api/pagination"
+	"localiza-compra/backend/internal/api/product"
+	"localiza-compra/backend/internal/api/store"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 )
@@ -46,29 +52,31 @@ func (h *shoppingHandler) CreateItem(w http.ResponseWriter, r *http.Request) {
 
 	itemToCreate := ShoppingListItem{
 		ShoppingListID: listID,
-		ProductID:      req.ProductID,
+		Barcode:        req.Barcode,
+		Name:           &req.Name,
+		Note:           &req.Note,
 		Quantity:       req.Quantity,
 	}
+	if req.ProductID != 0 {
+		itemToCreate.ProductID = &req.ProductID
+	}
 
-	createdList, err := h.service.CreateItem(r.Context(), userID, itemToCreate)
+	createdItem, created, err := h.service.CreateItem(r.Context(), userID, itemToCreate)
 
 	if err != nil {
-		if errors.Is(err, ErrShoppingListNotFound) {
-			http.Error(w, "Lista não encontrada", http.StatusNotFound)
-			return
-		}
-		if err.Error() == "não autorizado: você não é o dono desta lista" {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
-		}
-		log.Printf("Erro ao criar item: %v", err)
-		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+		writeListError(w, err, "Erro ao criar item")
 		return
 	}
 
+	// 200 quando o produto já estava na lista e só a quantidade foi somada
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(createdList)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(createdItem)
 }
 
 func (h *shoppingHandler) CreateList(w http.ResponseWriter, r *http.Request) {
@@ -93,8 +101,7 @@ func (h *shoppingHandler) CreateList(w http.ResponseWriter, r *http.Request) {
 
 	createdList, err := h.service.CreateList(r.Context(), listToCreate)
 	if err != nil {
-		log.Printf("Erro ao criar lista de compras: %v", err)
-		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+		writeListError(w, err, "Erro ao criar lista de compras")
 		return
 	}
 
@@ -103,6 +110,22 @@ func (h *shoppingHandler) CreateList(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(createdList)
 }
 
+// listOptions define a ordenação e os filtros aceitos em GET /shopping-lists
+var listOptions = pagination.Options{
+	Sorts: map[string]string{
+		"name":       "sl.name",
+		"created_at": "sl.created_at",
+		"item_count": "item_count",
+	},
+	DefaultSort: "-created_at",
+	Tiebreaker:  "sl.id",
+	Filters: map[string]pagination.Filter{
+		"name": {Column: "sl.name", Kind: pagination.FilterContains},
+		// ?role=owner traz só as listas próprias; editor/viewer, as compartilhadas
+		"role": {Column: "COALESCE(m.role, 'owner')", Kind: pagination.FilterText},
+	},
+}
+
 func (h *shoppingHandler) GetAllByUserID(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
 
@@ -111,13 +134,21 @@ func (h *shoppingHandler) GetAllByUserID(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	lists, err := h.service.GetAllByUserID(r.Context(), userID)
+	params, err := pagination.Parse(r, listOptions)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	lists, err := h.service.GetAllByUserID(r.Context(), userID, params)
 	if err != nil {
 		log.Printf("Erro ao buscar lists: %v", err)
 		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
 		return
 	}
 
+	lists.SetLinks(w, r)
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(lists)
@@ -139,8 +170,7 @@ func (h *shoppingHandler) GetAllItemsByListID(w http.ResponseWriter, r *http.Req
 
 	list, err := h.service.GetAllItemsByListID(r.Context(), userID, listID)
 	if err != nil {
-		log.Printf("Erro ao buscar lists: %v", err)
-		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+		writeListError(w, err, "Erro ao buscar itens da lista")
 		return
 	}
 
@@ -149,7 +179,7 @@ func (h *shoppingHandler) GetAllItemsByListID(w http.ResponseWriter, r *http.Req
 	json.NewEncoder(w).Encode(list)
 }
 
-func (h *shoppingHandler) UpdateItemStatus(w http.ResponseWriter, r *http.Request) {
+func (h *shoppingHandler) UpdateItem(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
 	if !ok {
 		http.Error(w, "ID do usuário inválido no contexto", http.StatusInternalServerError)
@@ -176,10 +206,172 @@ func (h *shoppingHandler) UpdateItemStatus(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = h.service.UpdateItemStatus(r.Context(), userID, listID, itemID, req.IsChecked)
+	err = h.service.UpdateItem(r.Context(), userID, listID, itemID, req)
 	if err != nil {
-		log.Printf("Erro ao buscar lists: %v", err)
-		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+		writeListError(w, err, "Erro ao atualizar item")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *shoppingHandler) DeleteItem(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "ID do usuário inválido no contexto", http.StatusInternalServerError)
+		return
+	}
+
+	listID, err := strconv.ParseInt(chi.URLParam(r, "listID"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID da lista inválido", http.StatusBadRequest)
+		return
+	}
+
+	itemID, err := strconv.ParseInt(chi.URLParam(r, "itemID"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID do produto inválido", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.DeleteItem(r.Context(), userID, listID, itemID); err != nil {
+		writeListError(w, err, "Erro ao remover item")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LinkItem vincula um item em texto livre a um produto. Quando o produto já
+// estava na lista, o item é somado a ele e a resposta traz o item do produto,
+// com outro ID.
+func (h *shoppingHandler) LinkItem(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "ID do usuário inválido no contexto", http.StatusInternalServerError)
+		return
+	}
+
+	listID, err := strconv.ParseInt(chi.URLParam(r, "listID"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID da lista inválido", http.StatusBadRequest)
+		return
+	}
+
+	itemID, err := strconv.ParseInt(chi.URLParam(r, "itemID"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID do produto inválido", http.StatusBadRequest)
+		return
+	}
+
+	var req LinkItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Corpo da requisição inválido", http.StatusBadRequest)
+		return
+	}
+
+	item, _, err := h.service.LinkItem(r.Context(), userID, listID, itemID, req)
+	if err != nil {
+		writeListError(w, err, "Erro ao vincular item")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(item)
+}
+
+const (
+	defaultSuggestionLimit = 5
+	maxSuggestionLimit     = 20
+)
+
+// SuggestProducts sugere produtos do catálogo para um item em texto livre,
+// usando a busca de produtos com o texto do item (?limit=, padrão 5).
+func (h *shoppingHandler) SuggestProducts(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "ID do usuário inválido no contexto", http.StatusInternalServerError)
+		return
+	}
+
+	listID, err := strconv.ParseInt(chi.URLParam(r, "listID"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID da lista inválido", http.StatusBadRequest)
+		return
+	}
+
+	itemID, err := strconv.ParseInt(chi.URLParam(r, "itemID"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID do produto inválido", http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultSuggestionLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxSuggestionLimit {
+			http.Error(w, fmt.Sprintf("limit deve ser um número entre 1 e %d", maxSuggestionLimit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	hits, err := h.service.SuggestProducts(r.Context(), userID, listID, itemID, limit)
+	if err != nil {
+		writeListError(w, err, "Erro ao sugerir produtos")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(hits)
+}
+
+func (h *shoppingHandler) RenameList(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "ID do usuário inválido no contexto", http.StatusInternalServerError)
+		return
+	}
+
+	listID, err := strconv.ParseInt(chi.URLParam(r, "listID"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID da lista inválido", http.StatusBadRequest)
+		return
+	}
+
+	var req RenameShoppingListRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Corpo da requisição inválido", http.StatusBadRequest)
+		return
+	}
+
+	list, err := h.service.RenameList(r.Context(), userID, listID, req.Name)
+	if err != nil {
+		writeListError(w, err, "Erro ao renomear lista")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(list)
+}
+
+func (h *shoppingHandler) DeleteList(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "ID do usuário inválido no contexto", http.StatusInternalServerError)
+		return
+	}
+
+	listID, err := strconv.ParseInt(chi.URLParam(r, "listID"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID da lista inválido", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.DeleteList(r.Context(), userID, listID); err != nil {
+		writeListError(w, err, "Erro ao excluir lista")
 		return
 	}
 
@@ -206,8 +398,7 @@ func (h *shoppingHandler) GetOptimizedList(w http.ResponseWriter, r *http.Reques
 
 	optimizedList, err := h.service.GetOptimizedList(r.Context(), userID, listID, storeID)
 	if err != nil {
-		log.Printf("Erro ao buscar produtos: %v", err)
-		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+		writeListError(w, err, "Erro ao buscar produtos")
 		return
 	}
 
@@ -215,3 +406,503 @@ func (h *shoppingHandler) GetOptimizedList(w http.ResponseWriter, r *http.Reques
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(optimizedList)
 }
+
+func (h *shoppingHandler) CompareStores(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "ID do utilizador não encontrado", http.StatusInternalServerError)
+		return
+	}
+	listID, err := strconv.ParseInt(chi.URLParam(r, "listID"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID da lista inválido", http.StatusBadRequest)
+		return
+	}
+
+	// storeIDs é opcional: "?storeIDs=1,2,3". Sem ele, comparamos todas as lojas
+	// (ou todas dentro do raio, com ?lat=&lng= ou ?cep= e ?radius_km=).
+	var storeIDs []int64
+	if param := r.URL.Query().Get("storeIDs"); param != "" {
+		for _, raw := range strings.Split(param, ",") {
+			storeID, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+			if err != nil {
+				http.Error(w, "ID da loja inválido no query parameter", http.StatusBadRequest)
+				return
+			}
+			storeIDs = append(storeIDs, storeID)
+		}
+	}
+
+	area, ok := parseArea(w, r)
+	if !ok {
+		return
+	}
+
+	comparisons, err := h.service.CompareStores(r.Context(), userID, listID, storeIDs, area)
+	if err != nil {
+		if writeAreaError(w, err) {
+			return
+		}
+		writeListError(w, err, "Erro ao comparar lojas")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(comparisons)
+}
+
+func (h *shoppingHandler) SplitBasket(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "ID do utilizador não encontrado", http.StatusInternalServerError)
+		return
+	}
+	listID, err := strconv.ParseInt(chi.URLParam(r, "listID"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID da lista inválido", http.StatusBadRequest)
+		return
+	}
+
+	maxStores := 2
+	if param := r.URL.Query().Get("maxStores"); param != "" {
+		maxStores, err = strconv.Atoi(param)
+		if err != nil || maxStores < 1 {
+			http.Error(w, "maxStores precisa ser um número maior que zero", http.StatusBadRequest)
+			return
+		}
+	}
+
+	area, ok := parseArea(w, r)
+	if !ok {
+		return
+	}
+
+	basket, err := h.service.SplitBasket(r.Context(), userID, listID, maxStores, area)
+	if err != nil {
+		if writeAreaError(w, err) {
+			return
+		}
+		writeListError(w, err, "Erro ao dividir a lista entre lojas")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(basket)
+}
+
+func (h *shoppingHandler) ListMembers(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "ID do usuário inválido no contexto", http.StatusInternalServerError)
+		return
+	}
+
+	listID, err := strconv.ParseInt(chi.URLParam(r, "listID"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID da lista inválido", http.StatusBadRequest)
+		return
+	}
+
+	members, err := h.service.ListMembers(r.Context(), userID, listID)
+	if err != nil {
+		writeListError(w, err, "Erro ao buscar participantes da lista")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(members)
+}
+
+// ShareList convida um e-mail como editor ou viewer e responde 202 com o
+// convite, tenha ou não conta com esse e-mail. Para quem já participa, muda o
+// papel e responde 200 com o colaborador.
+func (h *shoppingHandler) ShareList(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "ID do usuário inválido no contexto", http.StatusInternalServerError)
+		return
+	}
+
+	listID, err := strconv.ParseInt(chi.URLParam(r, "listID"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID da lista inválido", http.StatusBadRequest)
+		return
+	}
+
+	var req ShareListRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Corpo da requisição inválido", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.service.ShareList(r.Context(), userID, listID, req)
+	if err != nil {
+		writeListError(w, err, "Erro ao compartilhar lista")
+		return
+	}
+
+	status := http.StatusOK
+	if result.Invitation != nil {
+		status = http.StatusAccepted
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
+
+// ListInvitations lista os convites pendentes da lista, para o dono.
+func (h *shoppingHandler) ListInvitations(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "ID do usuário inválido no contexto", http.StatusInternalServerError)
+		return
+	}
+
+	listID, err := strconv.ParseInt(chi.URLParam(r, "listID"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID da lista inválido", http.StatusBadRequest)
+		return
+	}
+
+	invitations, err := h.service.ListInvitations(r.Context(), userID, listID)
+	if err != nil {
+		writeListError(w, err, "Erro ao buscar convites")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(invitations)
+}
+
+func (h *shoppingHandler) RevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "ID do usuário inválido no contexto", http.StatusInternalServerError)
+		return
+	}
+
+	listID, err := strconv.ParseInt(chi.URLParam(r, "listID"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID da lista inválido", http.StatusBadRequest)
+		return
+	}
+
+	invitationID, err := strconv.ParseInt(chi.URLParam(r, "invitationID"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID do convite inválido", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.RevokeInvitation(r.Context(), userID, listID, invitationID); err != nil {
+		writeListError(w, err, "Erro ao cancelar convite")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListUserInvitations lista os convites recebidos no e-mail do usuário.
+func (h *shoppingHandler) ListUserInvitations(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "ID do usuário inválido no contexto", http.StatusInternalServerError)
+		return
+	}
+
+	invitations, err := h.service.ListUserInvitations(r.Context(), userID)
+	if err != nil {
+		writeListError(w, err, "Erro ao buscar convites")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(invitations)
+}
+
+// AcceptInvitation aceita o convite e devolve a lista com o papel recebido.
+func (h *shoppingHandler) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "ID do usuário inválido no contexto", http.StatusInternalServerError)
+		return
+	}
+
+	invitationID, err := strconv.ParseInt(chi.URLParam(r, "invitationID"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID do convite inválido", http.StatusBadRequest)
+		return
+	}
+
+	list, err := h.service.AcceptInvitation(r.Context(), userID, invitationID)
+	if err != nil {
+		writeListError(w, err, "Erro ao aceitar convite")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(list)
+}
+
+func (h *shoppingHandler) DeclineInvitation(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "ID do usuário inválido no contexto", http.StatusInternalServerError)
+		return
+	}
+
+	invitationID, err := strconv.ParseInt(chi.URLParam(r, "invitationID"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID do convite inválido", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.DeclineInvitation(r.Context(), userID, invitationID); err != nil {
+		writeListError(w, err, "Erro ao recusar convite")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *shoppingHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "ID do usuário inválido no contexto", http.StatusInternalServerError)
+		return
+	}
+
+	listID, err := strconv.ParseInt(chi.URLParam(r, "listID"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID da lista inválido", http.StatusBadRequest)
+		return
+	}
+
+	memberID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID do usuário inválido", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.RemoveMember(r.Context(), userID, listID, memberID); err != nil {
+		writeListError(w, err, "Erro ao remover participante da lista")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *shoppingHandler) TransferOwnership(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "ID do usuário inválido no contexto", http.StatusInternalServerError)
+		return
+	}
+
+	listID, err := strconv.ParseInt(chi.URLParam(r, "listID"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID da lista inválido", http.StatusBadRequest)
+		return
+	}
+
+	var req TransferListRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Corpo da requisição inválido", http.StatusBadRequest)
+		return
+	}
+
+	list, err := h.service.TransferOwnership(r.Context(), userID, listID, req.UserID)
+	if err != nil {
+		writeListError(w, err, "Erro ao transferir lista")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(list)
+}
+
+// parseArea lê o raio de busca opcional (?lat=&lng= ou ?cep= e ?radius_km=).
+// Devolve nil sem localização; em caso de erro a resposta já foi escrita.
+func parseArea(w http.ResponseWriter, r *http.Request) (*store.NearbyQuery, bool) {
+	area, ok, err := store.ParseNearbyQuery(r)
+	if err != nil {
+		writeAreaError(w, err)
+		return nil, false
+	}
+	if !ok {
+		return nil, true
+	}
+	return &area, true
+}
+
+// writeAreaError responde aos erros de validação da localização, como CEP
+// inválido ou não encontrado.
+func writeAreaError(w http.ResponseWriter, err error) bool {
+	var validationErr *store.ValidationError
+	if !errors.As(err, &validationErr) {
+		return false
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(validationErr)
+	return true
+}
+
+// writeListError traduz os erros de lista e item; os demais vão para o log
+// com a mensagem logMsg e viram 500.
+func writeListError(w http.ResponseWriter, err error, logMsg string) {
+	switch {
+	case errors.Is(err, ErrShoppingListNotFound):
+		http.Error(w, "Lista não encontrada", http.StatusNotFound)
+	case errors.Is(err, ErrShoppingListItemNotFound):
+		http.Error(w, "Item não encontrado nesta lista", http.StatusNotFound)
+	case errors.Is(err, product.ErrProductNotFound):
+		http.Error(w, "Produto não encontrado", http.StatusNotFound)
+	case errors.Is(err, ErrMemberNotFound), errors.Is(err, ErrInvitationNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrNotListOwner), errors.Is(err, ErrListAccessDenied), errors.Is(err, ErrListReadOnly),
+		errors.Is(err, ErrEmailNotVerified):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, ErrCannotShareWithOwner), errors.Is(err, ErrOwnerCannotLeave), errors.Is(err, ErrItemAlreadyLinked):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, ErrInvalidListName), errors.Is(err, ErrInvalidQuantity), errors.Is(err, ErrNothingToUpdate),
+		errors.Is(err, ErrInvalidListRole), errors.Is(err, ErrInvalidInviteEmail), errors.Is(err, ErrItemNameRequired), errors.Is(err, ErrItemNameTooLong),
+		errors.Is(err, product.ErrInvalidBarcode):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		log.Printf("%s: %v", logMsg, err)
+		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+	}
+}
+
+const (
+	// Comentário enviado periodicamente para proxies não derrubarem a conexão
+	eventsHeartbeat = 25 * time.Second
+	// A conexão é encerrada depois deste tempo; o cliente reconecta com o
+	// Last-Event-ID e as permissões são conferidas de novo
+	eventsMaxDuration = 30 * time.Minute
+	eventsRetry       = 3 * time.Second
+)
+
+// Events mantém aberto um stream Server-Sent Events com as mudanças da lista.
+// Na reconexão, o EventSource manda o cabeçalho Last-Event-ID e recebe os
+// eventos que perdeu; ?last_event_id= faz o mesmo na primeira conexão.
+func (h *shoppingHandler) Events(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "ID do usuário inválido no contexto", http.StatusInternalServerError)
+		return
+	}
+
+	listID, err := strconv.ParseInt(chi.URLParam(r, "listID"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID da lista inválido", http.StatusBadRequest)
+		return
+	}
+
+	var lastEventID int64
+	raw := r.Header.Get("Last-Event-ID")
+	if raw == "" {
+		raw = r.URL.Query().Get("last_event_id")
+	}
+	if raw != "" {
+		lastEventID, err = strconv.ParseInt(raw, 10, 64)
+		if err != nil || lastEventID < 0 {
+			http.Error(w, "Last-Event-ID inválido", http.StatusBadRequest)
+			return
+		}
+	}
+
+	sub, err := h.service.Subscribe(r.Context(), userID, listID, lastEventID)
+	if err != nil {
+		writeListError(w, err, "Erro ao abrir os eventos da lista")
+		return
+	}
+	defer sub.Cancel()
+
+	rc := http.NewResponseController(w)
+	// O stream fica aberto bem além do WriteTimeout do servidor
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		log.Printf("Erro ao liberar o prazo de escrita do stream: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// Desliga o buffer do nginx, que seguraria os eventos
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: %d\n\n", eventsRetry.Milliseconds())
+	if sub.Resync {
+		writeEvent(w, Event{Type: EventResync, ListID: listID, At: time.Now()})
+	}
+	for _, e := range sub.Replay {
+		writeEvent(w, e)
+		if endsStream(e, userID) {
+			rc.Flush()
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+	deadline := time.NewTimer(eventsMaxDuration)
+	defer deadline.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-deadline.C:
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case e, ok := <-sub.Events:
+			if !ok {
+				return
+			}
+			writeEvent(w, e)
+			if endsStream(e, userID) {
+				rc.Flush()
+				return
+			}
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeEvent escreve um evento no formato SSE. O resync vai sem id para não
+// mudar o Last-Event-ID do cliente.
+func writeEvent(w http.ResponseWriter, e Event) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("Erro ao serializar evento da lista: %v", err)
+		return
+	}
+
+	if e.ID != 0 {
+		fmt.Fprintf(w, "id: %d\n", e.ID)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+}
+
+// endsStream diz se, depois deste evento, o usuário não tem mais o que ouvir
+// na lista.
+func endsStream(e Event, userID int64) bool {
+	return e.Type == EventListDeleted || (e.Type == EventMemberRemoved && e.UserID == userID)
+}
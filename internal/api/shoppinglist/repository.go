@@ -3,8 +3,12 @@ package shoppinglist
 import (
 	"context"
 	"errors"
+	"localiza-compra/backend/internal/api/pagination"
+	"localiza-compra/backend/internal/api/product"
 
+	sq "github.com/Masterminds/squirrel"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -29,17 +33,67 @@ func (r *pgxRepository) CreateList(ctx context.Context, list ShoppingList) (Shop
 	return list, nil
 }
 
-func (r *pgxRepository) CreateItem(ctx context.Context, item ShoppingListItem) (ShoppingListItem, error) {
-	query := `INSERT INTO shopping_list_items (shopping_list_id, product_id, quantity, is_checked)
-			VALUES ($1, $2, $3, $4)
-			RETURNING id`
+// itemColumns são as colunas lidas por scanItem.
+const itemColumns = "id, shopping_list_id, product_id, name, note, quantity, is_checked"
 
-	err := r.db.QueryRow(ctx, query, item.ShoppingListID, item.ProductID, item.Quantity, item.IsChecked).Scan(&item.ID)
+func scanItem(row pgx.Row) (ShoppingListItem, error) {
+	var item ShoppingListItem
+	err := row.Scan(&item.ID, &item.ShoppingListID, &item.ProductID, &item.Name, &item.Note, &item.Quantity, &item.IsChecked)
+	return item, err
+}
+
+// CreateItem adiciona o produto à lista. Se ele já estiver lá, soma a
+// quantidade na linha existente e volta a desmarcá-la; o booleano indica se a
+// linha foi criada. Itens em texto livre (sem produto) nunca conflitam.
+func (r *pgxRepository) CreateItem(ctx context.Context, item ShoppingListItem) (ShoppingListItem, bool, error) {
+	query := `INSERT INTO shopping_list_items (shopping_list_id, product_id, name, note, quantity, is_checked)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (shopping_list_id, product_id) DO UPDATE
+			SET quantity = shopping_list_items.quantity + EXCLUDED.quantity,
+				is_checked = false,
+				note = COALESCE(EXCLUDED.note, shopping_list_items.note)
+			RETURNING id, name, note, quantity, is_checked, (xmax = 0) AS inserted`
+
+	var created bool
+	err := r.db.QueryRow(ctx, query, item.ShoppingListID, item.ProductID, item.Name, item.Note, item.Quantity, item.IsChecked).
+		Scan(&item.ID, &item.Name, &item.Note, &item.Quantity, &item.IsChecked, &created)
 	if err != nil {
-		return ShoppingListItem{}, err
+		if isForeignKeyViolation(err) {
+			return ShoppingListItem{}, false, product.ErrProductNotFound
+		}
+		return ShoppingListItem{}, false, err
 	}
 
-	return item, nil
+	return item, created, nil
+}
+
+func (r *pgxRepository) RenameList(ctx context.Context, listID int64, name string) (ShoppingList, error) {
+	query := `UPDATE shopping_lists SET name = $2 WHERE id = $1 RETURNING id, user_id, name, created_at`
+
+	var list ShoppingList
+
+	err := r.db.QueryRow(ctx, query, listID, name).Scan(&list.ID, &list.UserID, &list.Name, &list.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ShoppingList{}, ErrShoppingListNotFound
+		}
+		return ShoppingList{}, err
+	}
+
+	return list, nil
+}
+
+func (r *pgxRepository) DeleteList(ctx context.Context, listID int64) error {
+	tag, err := r.db.Exec(ctx, `DELETE FROM shopping_lists WHERE id = $1`, listID)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrShoppingListNotFound
+	}
+
+	return nil
 }
 
 func (r *pgxRepository) GetShoppingListByID(ctx context.Context, id int64) (ShoppingList, error) {
@@ -58,26 +112,31 @@ func (r *pgxRepository) GetShoppingListByID(ctx context.Context, id int64) (Shop
 	return list, nil
 }
 
-func (r *pgxRepository) GetAllByUserID(ctx context.Context, userID int64) ([]ShoppingList, error) {
-	query := `SELECT
-			sl.id,
-			sl.user_id,
-			sl.name,
-			sl.created_at,
-			COUNT(sli.id) AS item_count
-		FROM
-			shopping_lists sl
-		LEFT JOIN
-			shopping_list_items sli ON sl.id = sli.shopping_list_id
-		WHERE
-			sl.user_id = $1
-		GROUP BY
-			sl.id;
-		`
+func (r *pgxRepository) GetAllByUserID(ctx context.Context, userID int64, params pagination.Params) ([]ShoppingList, int, error) {
+	// Listas próprias e as compartilhadas com o usuário
+	base := sq.Select().
+		From("shopping_lists sl").
+		LeftJoin("shopping_list_members m ON m.list_id = sl.id AND m.user_id = ?", userID).
+		Where(sq.Or{sq.Eq{"sl.user_id": userID}, sq.NotEq{"m.user_id": nil}}).
+		PlaceholderFormat(sq.Dollar)
 
-	rows, err := r.db.Query(ctx, query, userID)
+	total, err := pagination.Count(ctx, r.db, params.Filter(base.Columns("COUNT(*)")))
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+
+	query, args, err := params.Apply(base.
+		Columns("sl.id", "sl.user_id", "sl.name", "sl.created_at", "COUNT(sli.id) AS item_count", "COALESCE(m.role, 'owner') AS role").
+		LeftJoin("shopping_list_items sli ON sl.id = sli.shopping_list_id").
+		GroupBy("sl.id", "m.role"),
+	).ToSql()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
 	}
 
 	defer rows.Close()
@@ -86,34 +145,37 @@ func (r *pgxRepository) GetAllByUserID(ctx context.Context, userID int64) ([]Sho
 	for rows.Next() {
 		var l ShoppingList
 
-		err := rows.Scan(&l.ID, &l.UserID, &l.Name, &l.CreatedAt, &l.ItemCount)
+		err := rows.Scan(&l.ID, &l.UserID, &l.Name, &l.CreatedAt, &l.ItemCount, &l.Role)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 
 		lists = append(lists, l)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	return lists, nil
+	return lists, total, nil
 }
 
 func (r *pgxRepository) GetAllItemsByListID(ctx context.Context, listID int64) ([]ListItemDetail, error) {
 	query := `SELECT
 			sli.id,
 			sli.product_id,
-			p.name AS product_name,
+			COALESCE(p.name, sli.name) AS product_name,
+			sli.note,
 			sli.quantity,
 			sli.is_checked
 		FROM
 			shopping_list_items sli
-		JOIN
+		LEFT JOIN
 			products p ON sli.product_id = p.id
 		WHERE
-			sli.shopping_list_id = $1;
+			sli.shopping_list_id = $1
+		ORDER BY
+			sli.id;
 		`
 	rows, err := r.db.Query(ctx, query, listID)
 	if err != nil {
@@ -127,7 +189,7 @@ func (r *pgxRepository) GetAllItemsByListID(ctx context.Context, listID int64) (
 	for rows.Next() {
 		var i ListItemDetail
 
-		err := rows.Scan(&i.ID, &i.ProductID, &i.Name, &i.Quantity, &i.IsChecked)
+		err := rows.Scan(&i.ID, &i.ProductID, &i.Name, &i.Note, &i.Quantity, &i.IsChecked)
 		if err != nil {
 			return nil, err
 		}
@@ -142,10 +204,115 @@ func (r *pgxRepository) GetAllItemsByListID(ctx context.Context, listID int64) (
 	return items, nil
 }
 
-func (r *pgxRepository) UpdateItemStatus(ctx context.Context, itemID int64, isChecked bool) error {
-	query := `UPDATE shopping_list_items SET is_checked = $1 WHERE id = $2`
+func (r *pgxRepository) GetItem(ctx context.Context, listID, itemID int64) (ShoppingListItem, error) {
+	query := `SELECT ` + itemColumns + ` FROM shopping_list_items WHERE id = $1 AND shopping_list_id = $2`
+
+	item, err := scanItem(r.db.QueryRow(ctx, query, itemID, listID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ShoppingListItem{}, ErrShoppingListItemNotFound
+		}
+		return ShoppingListItem{}, err
+	}
+
+	return item, nil
+}
+
+// LinkItem vincula o item em texto livre ao produto. Se o produto já estiver
+// na lista, a quantidade e a observação vão para a linha existente e o item
+// em texto livre é apagado, como no CreateItem; o booleano indica essa fusão.
+func (r *pgxRepository) LinkItem(ctx context.Context, listID, itemID, productID int64) (ShoppingListItem, bool, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return ShoppingListItem{}, false, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	query := `SELECT ` + itemColumns + ` FROM shopping_list_items WHERE id = $1 AND shopping_list_id = $2 FOR UPDATE`
+
+	item, err := scanItem(tx.QueryRow(ctx, query, itemID, listID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ShoppingListItem{}, false, ErrShoppingListItemNotFound
+		}
+		return ShoppingListItem{}, false, err
+	}
+	if item.ProductID != nil {
+		return ShoppingListItem{}, false, ErrItemAlreadyLinked
+	}
+
+	query = `UPDATE shopping_list_items
+			SET quantity = quantity + $3, is_checked = false, note = COALESCE(note, $4)
+			WHERE shopping_list_id = $1 AND product_id = $2
+			RETURNING ` + itemColumns
+
+	existing, err := scanItem(tx.QueryRow(ctx, query, listID, productID, item.Quantity, item.Note))
+	merged := err == nil
+	switch {
+	case merged:
+		if _, err = tx.Exec(ctx, `DELETE FROM shopping_list_items WHERE id = $1`, itemID); err != nil {
+			return ShoppingListItem{}, false, err
+		}
+		item = existing
+	case errors.Is(err, pgx.ErrNoRows):
+		// O texto digitado fica guardado em name, mas a lista passa a mostrar o produto
+		query = `UPDATE shopping_list_items SET product_id = $2 WHERE id = $1 RETURNING ` + itemColumns
+		item, err = scanItem(tx.QueryRow(ctx, query, itemID, productID))
+		if err != nil {
+			if isForeignKeyViolation(err) {
+				return ShoppingListItem{}, false, product.ErrProductNotFound
+			}
+			return ShoppingListItem{}, false, err
+		}
+	default:
+		return ShoppingListItem{}, false, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return ShoppingListItem{}, false, err
+	}
+
+	return item, merged, nil
+}
+
+// UpdateItem só altera o item se ele pertencer a listID.
+func (r *pgxRepository) UpdateItem(ctx context.Context, listID, itemID int64, req UpdateItemRequest) (ShoppingListItem, error) {
+	updateBuilder := sq.Update("shopping_list_items").
+		Where(sq.Eq{"id": itemID, "shopping_list_id": listID}).
+		Suffix("RETURNING " + itemColumns).
+		PlaceholderFormat(sq.Dollar)
+	if req.IsChecked != nil {
+		updateBuilder = updateBuilder.Set("is_checked", *req.IsChecked)
+	}
+	if req.Quantity != nil {
+		updateBuilder = updateBuilder.Set("quantity", *req.Quantity)
+	}
+	if req.Note != nil {
+		// Observação vazia vira NULL
+		updateBuilder = updateBuilder.Set("note", sq.Expr("NULLIF(?, '')", *req.Note))
+	}
+
+	sql, args, err := updateBuilder.ToSql()
+	if err != nil {
+		return ShoppingListItem{}, err
+	}
+
+	item, err := scanItem(r.db.QueryRow(ctx, sql, args...))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ShoppingListItem{}, ErrShoppingListItemNotFound
+		}
+		return ShoppingListItem{}, err
+	}
+
+	return item, nil
+}
+
+func (r *pgxRepository) DeleteItem(ctx context.Context, listID, itemID int64) error {
+	query := `DELETE FROM shopping_list_items WHERE id = $1 AND shopping_list_id = $2`
 
-	tag, err := r.db.Exec(ctx, query, isChecked, itemID)
+	tag, err := r.db.Exec(ctx, query, itemID, listID)
 	if err != nil {
 		return err
 	}
@@ -171,8 +338,10 @@ func (r *pgxRepository) GetOptimizedList(ctx context.Context, listID, storeID in
 			products p ON sli.product_id = p.id
 		JOIN
 			stock_items si ON sli.product_id = si.product_id
+		JOIN
+			stores s ON si.store_id = s.id
 		WHERE
-			sli.shopping_list_id = $1 AND si.store_id = $2
+			sli.shopping_list_id = $1 AND si.store_id = $2 AND s.status = 'approved'
 		ORDER BY
 			si.sector`
 	rows, err := r.db.Query(ctx, query, listID, storeID)
@@ -201,3 +370,149 @@ func (r *pgxRepository) GetOptimizedList(ctx context.Context, listID, storeID in
 
 	return items, nil
 }
+
+// GetUnlinkedItems devolve os itens da lista que ainda não têm produto.
+func (r *pgxRepository) GetUnlinkedItems(ctx context.Context, listID int64) ([]UnlinkedItem, error) {
+	query := `SELECT id, name, note, quantity, is_checked
+			FROM shopping_list_items
+			WHERE shopping_list_id = $1 AND product_id IS NULL
+			ORDER BY id`
+
+	rows, err := r.db.Query(ctx, query, listID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	items := make([]UnlinkedItem, 0)
+
+	for rows.Next() {
+		var i UnlinkedItem
+
+		err := rows.Scan(&i.ItemID, &i.Name, &i.Note, &i.Quantity, &i.IsChecked)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, i)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// GetListPricesByStores cruza cada item da lista com o estoque de todas as lojas
+// aprovadas (ou apenas das lojas em storeIDs). Itens que a loja não vende vêm
+// com preço nulo.
+func (r *pgxRepository) GetListPricesByStores(ctx context.Context, listID int64, storeIDs []int64) ([]StoreItemPrice, error) {
+	query := `SELECT
+			s.id,
+			s.name,
+			p.id,
+			p.name,
+			sli.quantity,
+			MIN(si.price)
+		FROM
+			stores s
+		CROSS JOIN
+			shopping_list_items sli
+		JOIN
+			products p ON sli.product_id = p.id
+		LEFT JOIN
+			stock_items si ON sli.product_id = si.product_id AND si.store_id = s.id
+		WHERE
+			sli.shopping_list_id = $1 AND s.status = 'approved' AND ($2::bigint[] IS NULL OR s.id = ANY($2))
+		GROUP BY
+			s.id, s.name, sli.id, p.id, p.name, sli.quantity
+		ORDER BY
+			s.id, sli.id`
+
+	rows, err := r.db.Query(ctx, query, listID, storeIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	prices := make([]StoreItemPrice, 0)
+
+	for rows.Next() {
+		var p StoreItemPrice
+
+		err := rows.Scan(&p.StoreID, &p.StoreName, &p.ProductID, &p.ProductName, &p.Quantity, &p.Price)
+		if err != nil {
+			return nil, err
+		}
+
+		prices = append(prices, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return prices, nil
+}
+
+// GetStockOffers devolve, para cada item da lista, as lojas aprovadas (ou só as
+// de storeIDs) que têm o produto com quantidade suficiente em estoque.
+func (r *pgxRepository) GetStockOffers(ctx context.Context, listID int64, storeIDs []int64) ([]StockOffer, error) {
+	query := `SELECT
+			sli.id,
+			p.id,
+			p.name,
+			sli.quantity,
+			s.id,
+			s.name,
+			si.price,
+			si.sector
+		FROM
+			shopping_list_items sli
+		JOIN
+			products p ON sli.product_id = p.id
+		JOIN
+			stock_items si ON sli.product_id = si.product_id
+		JOIN
+			stores s ON si.store_id = s.id
+		WHERE
+			sli.shopping_list_id = $1 AND si.quantity >= sli.quantity AND s.status = 'approved'
+			AND ($2::bigint[] IS NULL OR s.id = ANY($2))
+		ORDER BY
+			sli.id, si.price`
+
+	rows, err := r.db.Query(ctx, query, listID, storeIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	offers := make([]StockOffer, 0)
+
+	for rows.Next() {
+		var o StockOffer
+
+		err := rows.Scan(&o.ItemID, &o.ProductID, &o.ProductName, &o.Quantity, &o.StoreID, &o.StoreName, &o.Price, &o.Sector)
+		if err != nil {
+			return nil, err
+		}
+
+		offers = append(offers, o)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return offers, nil
+}
+
+// isForeignKeyViolation indica um product_id que não existe no catálogo.
+func isForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23503"
+}
@@ -3,79 +3,421 @@ package shoppinglist
 import (
 	"context"
 	"errors"
+	"localiza-compra/backend/internal/api/pagination"
+	"localiza-compra/backend/internal/api/product"
+	"localiza-compra/backend/internal/api/store"
+	"localiza-compra/backend/internal/mailer"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
 )
 
 type shoppingService struct {
-	repo Repository
+	repo        Repository
+	productRepo product.Repository
+	locator     StoreLocator
+	events      *Broker
+	mailer      mailer.Mailer
+	appURL      string
 }
 
-func NewService(r Repository) Service {
+func NewService(r Repository, pr product.Repository, l StoreLocator, events *Broker, m mailer.Mailer, appURL string) Service {
 	return &shoppingService{
-		repo: r,
+		repo:        r,
+		productRepo: pr,
+		locator:     l,
+		events:      events,
+		mailer:      m,
+		appURL:      appURL,
 	}
 }
 
-func (s *shoppingService) CreateItem(ctx context.Context, userID int64, item ShoppingListItem) (ShoppingListItem, error) {
-	list, err := s.repo.GetShoppingListByID(ctx, item.ShoppingListID)
+func (s *shoppingService) CreateItem(ctx context.Context, userID int64, item ShoppingListItem) (ShoppingListItem, bool, error) {
+	if item.Quantity < 1 {
+		return ShoppingListItem{}, false, ErrInvalidQuantity
+	}
+
+	if _, err := s.authorize(ctx, userID, item.ShoppingListID, ListRoleEditor); err != nil {
+		return ShoppingListItem{}, false, err
+	}
+
+	item.Note = optionalText(item.Note)
+	if item.ProductID != nil || item.Barcode != "" {
+		var productID int64
+		if item.ProductID != nil {
+			productID = *item.ProductID
+		}
+		resolved, err := product.ResolveID(ctx, s.productRepo, productID, item.Barcode)
+		if err != nil {
+			return ShoppingListItem{}, false, err
+		}
+		item.ProductID = &resolved
+		item.Name = nil
+	} else {
+		// Item em texto livre, para ser vinculado a um produto depois
+		item.Name = optionalText(item.Name)
+		if item.Name == nil {
+			return ShoppingListItem{}, false, ErrItemNameRequired
+		}
+		if utf8.RuneCountInString(*item.Name) > maxItemNameLength {
+			return ShoppingListItem{}, false, ErrItemNameTooLong
+		}
+	}
+
+	created, isNew, err := s.repo.CreateItem(ctx, item)
 	if err != nil {
-		return ShoppingListItem{}, err
+		return ShoppingListItem{}, false, err
 	}
 
-	if list.UserID != userID {
-		return ShoppingListItem{}, errors.New("não autorizado: você não é o dono desta lista")
+	eventType := EventItemQuantityChanged
+	if isNew {
+		eventType = EventItemAdded
 	}
-	return s.repo.CreateItem(ctx, item)
+	s.events.Publish(Event{Type: eventType, ListID: created.ShoppingListID, ActorID: userID, Item: &created})
+
+	return created, isNew, nil
 }
 
 func (s *shoppingService) CreateList(ctx context.Context, list ShoppingList) (ShoppingList, error) {
-	return s.repo.CreateList(ctx, list)
+	list.Name = strings.TrimSpace(list.Name)
+	if list.Name == "" {
+		return ShoppingList{}, ErrInvalidListName
+	}
+	created, err := s.repo.CreateList(ctx, list)
+	if err != nil {
+		return ShoppingList{}, err
+	}
+	created.Role = ListRoleOwner
+	return created, nil
 }
 
-func (s *shoppingService) GetAllByUserID(ctx context.Context, userID int64) ([]ShoppingList, error) {
-	return s.repo.GetAllByUserID(ctx, userID)
+func (s *shoppingService) RenameList(ctx context.Context, userID, listID int64, name string) (ShoppingList, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return ShoppingList{}, ErrInvalidListName
+	}
+
+	if _, err := s.authorize(ctx, userID, listID, ListRoleEditor); err != nil {
+		return ShoppingList{}, err
+	}
+
+	return s.repo.RenameList(ctx, listID, name)
 }
 
-func (s *shoppingService) GetAllItemsByListID(ctx context.Context, userID, listID int64) ([]ListItemDetail, error) {
-	list, err := s.repo.GetShoppingListByID(ctx, listID)
+// DeleteList apaga a lista; os itens vão junto pelo ON DELETE CASCADE.
+func (s *shoppingService) DeleteList(ctx context.Context, userID, listID int64) error {
+	if _, err := s.authorize(ctx, userID, listID, ListRoleOwner); err != nil {
+		return err
+	}
+
+	if err := s.repo.DeleteList(ctx, listID); err != nil {
+		return err
+	}
+
+	s.events.Publish(Event{Type: EventListDeleted, ListID: listID, ActorID: userID})
+	return nil
+}
+
+func (s *shoppingService) GetAllByUserID(ctx context.Context, userID int64, params pagination.Params) (pagination.Page[ShoppingList], error) {
+	lists, total, err := s.repo.GetAllByUserID(ctx, userID, params)
 	if err != nil {
-		return nil, err
+		return pagination.Page[ShoppingList]{}, err
 	}
+	return pagination.NewPage(lists, total, params), nil
+}
 
-	// 2. A VERIFICAÇÃO DE SEGURANÇA!
-	if list.UserID != userID {
-		return nil, errors.New("não autorizado")
+func (s *shoppingService) GetAllItemsByListID(ctx context.Context, userID, listID int64) ([]ListItemDetail, error) {
+	if _, err := s.authorize(ctx, userID, listID, ListRoleViewer); err != nil {
+		return nil, err
 	}
 
 	return s.repo.GetAllItemsByListID(ctx, listID)
 }
 
-func (s *shoppingService) UpdateItemStatus(ctx context.Context, userID, listID, itemID int64, isChecked bool) error {
-	// 1. Buscamos a lista para descobrir o dono
-	list, err := s.repo.GetShoppingListByID(ctx, listID)
+// UpdateItem marca/desmarca o item, muda a quantidade ou a observação. O item
+// precisa pertencer à lista da URL, e não só ao usuário.
+func (s *shoppingService) UpdateItem(ctx context.Context, userID, listID, itemID int64, req UpdateItemRequest) error {
+	if req.IsChecked == nil && req.Quantity == nil && req.Note == nil {
+		return ErrNothingToUpdate
+	}
+	if req.Quantity != nil && *req.Quantity < 1 {
+		return ErrInvalidQuantity
+	}
+	if req.Note != nil {
+		note := strings.TrimSpace(*req.Note)
+		req.Note = &note
+	}
+
+	if _, err := s.authorize(ctx, userID, listID, ListRoleEditor); err != nil {
+		return err
+	}
+
+	item, err := s.repo.UpdateItem(ctx, listID, itemID, req)
 	if err != nil {
-		return err // Devolve o erro de "não encontrado" se a lista não existir
+		return err
 	}
 
-	// 2. A verificação de segurança!
-	if list.UserID != userID {
-		return errors.New("não autorizado")
+	if req.IsChecked != nil {
+		s.events.Publish(Event{Type: EventItemChecked, ListID: listID, ActorID: userID, Item: &item})
+	}
+	if req.Quantity != nil {
+		s.events.Publish(Event{Type: EventItemQuantityChanged, ListID: listID, ActorID: userID, Item: &item})
+	}
+	if req.Note != nil {
+		s.events.Publish(Event{Type: EventItemNoteChanged, ListID: listID, ActorID: userID, Item: &item})
+	}
+	return nil
+}
+
+func (s *shoppingService) DeleteItem(ctx context.Context, userID, listID, itemID int64) error {
+	if _, err := s.authorize(ctx, userID, listID, ListRoleEditor); err != nil {
+		return err
+	}
+
+	if err := s.repo.DeleteItem(ctx, listID, itemID); err != nil {
+		return err
+	}
+
+	s.events.Publish(Event{
+		Type:    EventItemRemoved,
+		ListID:  listID,
+		ActorID: userID,
+		Item:    &ShoppingListItem{ID: itemID, ShoppingListID: listID},
+	})
+	return nil
+}
+
+// LinkItem vincula um item em texto livre a um produto do catálogo. O
+// booleano indica que o produto já estava na lista e o item foi somado a ele.
+func (s *shoppingService) LinkItem(ctx context.Context, userID, listID, itemID int64, req LinkItemRequest) (ShoppingListItem, bool, error) {
+	if _, err := s.authorize(ctx, userID, listID, ListRoleEditor); err != nil {
+		return ShoppingListItem{}, false, err
+	}
+
+	productID, err := product.ResolveID(ctx, s.productRepo, req.ProductID, req.Barcode)
+	if err != nil {
+		return ShoppingListItem{}, false, err
+	}
+
+	item, merged, err := s.repo.LinkItem(ctx, listID, itemID, productID)
+	if err != nil {
+		return ShoppingListItem{}, false, err
+	}
+
+	if merged {
+		s.events.Publish(Event{
+			Type:    EventItemRemoved,
+			ListID:  listID,
+			ActorID: userID,
+			Item:    &ShoppingListItem{ID: itemID, ShoppingListID: listID},
+		})
+		s.events.Publish(Event{Type: EventItemQuantityChanged, ListID: listID, ActorID: userID, Item: &item})
+	} else {
+		s.events.Publish(Event{Type: EventItemLinked, ListID: listID, ActorID: userID, Item: &item})
 	}
 
-	// 3. Se a verificação passar, mandamos o repositório fazer a atualização.
-	// Note que o repositório só precisa do itemID e do isChecked.
-	return s.repo.UpdateItemStatus(ctx, itemID, isChecked)
+	return item, merged, nil
 }
 
-func (s *shoppingService) GetOptimizedList(ctx context.Context, userID, listID, storeID int64) ([]OptimizedListItem, error) {
-	// Verificação de segurança: o utilizador é o dono da lista?
-	list, err := s.repo.GetShoppingListByID(ctx, listID)
+// SuggestProducts busca no catálogo os produtos que combinam com o texto de
+// um item ainda não vinculado.
+func (s *shoppingService) SuggestProducts(ctx context.Context, userID, listID, itemID int64, limit int) ([]product.SearchHit, error) {
+	if _, err := s.authorize(ctx, userID, listID, ListRoleViewer); err != nil {
+		return nil, err
+	}
+
+	item, err := s.repo.GetItem(ctx, listID, itemID)
 	if err != nil {
 		return nil, err
 	}
-	if list.UserID != userID {
-		return nil, errors.New("não autorizado")
+	if item.ProductID != nil {
+		return nil, ErrItemAlreadyLinked
+	}
+
+	return s.productRepo.Suggest(ctx, *item.Name, limit)
+}
+
+func (s *shoppingService) GetOptimizedList(ctx context.Context, userID, listID, storeID int64) (OptimizedList, error) {
+	// Verificação de segurança: o utilizador tem acesso à lista?
+	if _, err := s.authorize(ctx, userID, listID, ListRoleViewer); err != nil {
+		return OptimizedList{}, err
 	}
 
 	// Se for, busca a lista otimizada
-	return s.repo.GetOptimizedList(ctx, listID, storeID)
+	items, err := s.repo.GetOptimizedList(ctx, listID, storeID)
+	if err != nil {
+		return OptimizedList{}, err
+	}
+
+	// Itens sem produto não têm preço nem setor, mas o usuário precisa vê-los
+	unlinked, err := s.repo.GetUnlinkedItems(ctx, listID)
+	if err != nil {
+		return OptimizedList{}, err
+	}
+
+	return OptimizedList{Items: items, UnlinkedItems: unlinked}, nil
+}
+
+func (s *shoppingService) CompareStores(ctx context.Context, userID, listID int64, storeIDs []int64, area *store.NearbyQuery) ([]StoreComparison, error) {
+	if _, err := s.authorize(ctx, userID, listID, ListRoleViewer); err != nil {
+		return nil, err
+	}
+
+	candidates, err := s.candidateStores(ctx, storeIDs, area)
+	if err != nil {
+		return nil, err
+	}
+
+	prices, err := s.repo.GetListPricesByStores(ctx, listID, candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	unlinked, err := s.repo.GetUnlinkedItems(ctx, listID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Agrupa as linhas por loja, mantendo a ordem em que vieram do banco
+	byStore := make(map[int64]*StoreComparison)
+	order := make([]int64, 0)
+	for _, p := range prices {
+		c, ok := byStore[p.StoreID]
+		if !ok {
+			c = &StoreComparison{
+				StoreID:       p.StoreID,
+				StoreName:     p.StoreName,
+				MissingItems:  make([]MissingItem, 0),
+				UnlinkedItems: unlinked,
+			}
+			byStore[p.StoreID] = c
+			order = append(order, p.StoreID)
+		}
+
+		c.ItemsTotal++
+		if p.Price == nil {
+			c.MissingItems = append(c.MissingItems, MissingItem{
+				ProductID:   p.ProductID,
+				ProductName: p.ProductName,
+				Quantity:    p.Quantity,
+			})
+			continue
+		}
+		c.ItemsCovered++
+		c.Total += *p.Price * float64(p.Quantity)
+	}
+
+	comparisons := make([]StoreComparison, 0, len(order))
+	for _, id := range order {
+		c := byStore[id]
+		// Sem filtro explícito, lojas que não vendem nada da lista só atrapalham
+		if len(storeIDs) == 0 && c.ItemsCovered == 0 {
+			continue
+		}
+		c.Total = roundMoney(c.Total)
+		comparisons = append(comparisons, *c)
+	}
+
+	// Da mais barata para a mais cara; uma loja que não tem um item não pode
+	// ficar na frente só porque o total dela é menor
+	sort.SliceStable(comparisons, func(i, j int) bool {
+		if len(comparisons[i].MissingItems) != len(comparisons[j].MissingItems) {
+			return len(comparisons[i].MissingItems) < len(comparisons[j].MissingItems)
+		}
+		return comparisons[i].Total < comparisons[j].Total
+	})
+
+	return comparisons, nil
+}
+
+func (s *shoppingService) SplitBasket(ctx context.Context, userID, listID int64, maxStores int, area *store.NearbyQuery) (SplitBasket, error) {
+	if maxStores < 1 {
+		return SplitBasket{}, errors.New("o número máximo de lojas precisa ser pelo menos 1")
+	}
+
+	if _, err := s.authorize(ctx, userID, listID, ListRoleViewer); err != nil {
+		return SplitBasket{}, err
+	}
+
+	items, err := s.repo.GetAllItemsByListID(ctx, listID)
+	if err != nil {
+		return SplitBasket{}, err
+	}
+
+	candidates, err := s.candidateStores(ctx, nil, area)
+	if err != nil {
+		return SplitBasket{}, err
+	}
+
+	offers, err := s.repo.GetStockOffers(ctx, listID, candidates)
+	if err != nil {
+		return SplitBasket{}, err
+	}
+
+	// Itens sem produto não entram na divisão nem contam como faltantes
+	linked := make([]ListItemDetail, 0, len(items))
+	unlinked := make([]UnlinkedItem, 0)
+	for _, item := range items {
+		if item.ProductID == nil {
+			unlinked = append(unlinked, UnlinkedItem{
+				ItemID:    item.ID,
+				Name:      item.Name,
+				Note:      item.Note,
+				Quantity:  item.Quantity,
+				IsChecked: item.IsChecked,
+			})
+			continue
+		}
+		linked = append(linked, item)
+	}
+
+	basket := solveSplit(linked, offers, maxStores)
+	basket.UnlinkedItems = unlinked
+	return basket, nil
+}
+
+// candidateStores junta o filtro explícito de lojas com o raio de busca. nil
+// significa todas as lojas; uma lista vazia, que nenhuma loja serve.
+func (s *shoppingService) candidateStores(ctx context.Context, storeIDs []int64, area *store.NearbyQuery) ([]int64, error) {
+	if area == nil {
+		return storeIDs, nil
+	}
+
+	nearby, err := s.locator.NearbyIDs(ctx, *area)
+	if err != nil {
+		return nil, err
+	}
+	if len(storeIDs) == 0 {
+		return nearby, nil
+	}
+
+	candidates := make([]int64, 0, len(storeIDs))
+	for _, id := range storeIDs {
+		if slices.Contains(nearby, id) {
+			candidates = append(candidates, id)
+		}
+	}
+	return candidates, nil
+}
+
+// Subscribe abre o canal de eventos da lista para quem tem acesso a ela.
+func (s *shoppingService) Subscribe(ctx context.Context, userID, listID, lastEventID int64) (Subscription, error) {
+	if _, err := s.authorize(ctx, userID, listID, ListRoleViewer); err != nil {
+		return Subscription{}, err
+	}
+
+	return s.events.Subscribe(listID, lastEventID), nil
+}
+
+// optionalText tira os espaços do texto e troca o texto vazio por nil.
+func optionalText(text *string) *string {
+	if text == nil {
+		return nil
+	}
+	trimmed := strings.TrimSpace(*text)
+	if trimmed == "" {
+		return nil
+	}
+	return &trimmed
 }
@@ -0,0 +1,545 @@
+package shoppinglist
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"localiza-compra/backend/internal/mailer"
+	"log"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ListRole é o papel do usuário numa lista: o dono faz tudo, o editor mexe
+// nos itens e no nome, e o leitor só vê.
+type ListRole string
+
+const (
+	ListRoleOwner  ListRole = "owner"
+	ListRoleEditor ListRole = "editor"
+	ListRoleViewer ListRole = "viewer"
+)
+
+var listRoleRank = map[ListRole]int{
+	ListRoleViewer: 1,
+	ListRoleEditor: 2,
+	ListRoleOwner:  3,
+}
+
+// allows diz se o papel r basta para uma ação que exige need.
+func (r ListRole) allows(need ListRole) bool {
+	return listRoleRank[r] >= listRoleRank[need]
+}
+
+var (
+	ErrListAccessDenied     = errors.New("não autorizado: você não tem acesso a esta lista")
+	ErrListReadOnly         = errors.New("não autorizado: você só pode ver esta lista")
+	ErrInvalidListRole      = errors.New("o papel precisa ser editor ou viewer")
+	ErrInvalidInviteEmail   = errors.New("e-mail inválido")
+	ErrInvitationNotFound   = errors.New("convite não encontrado")
+	ErrEmailNotVerified     = errors.New("confirme o seu e-mail antes de aceitar o convite")
+	ErrCannotShareWithOwner = errors.New("o dono já tem acesso à lista")
+	ErrMemberNotFound       = errors.New("o usuário não participa desta lista")
+	ErrOwnerCannotLeave     = errors.New("o dono não pode sair da lista; transfira a lista ou exclua")
+)
+
+type ListMember struct {
+	UserID  int64     `json:"user_id"`
+	Name    string    `json:"name"`
+	Email   string    `json:"email"`
+	Role    ListRole  `json:"role"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+// ListInvitation é um convite pendente para participar de uma lista.
+type ListInvitation struct {
+	ID        int64     `json:"id"`
+	ListID    int64     `json:"list_id"`
+	ListName  string    `json:"list_name,omitempty"`
+	Email     string    `json:"email"`
+	Role      ListRole  `json:"role"`
+	InvitedBy *int64    `json:"invited_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ShareResult traz o colaborador com o papel novo, quando o e-mail já
+// participa da lista, ou o convite criado. Um e-mail sem conta e um com conta
+// que ainda não participa recebem a mesma resposta.
+type ShareResult struct {
+	Member     *ListMember     `json:"member,omitempty"`
+	Invitation *ListInvitation `json:"invitation,omitempty"`
+}
+
+type ShareListRequest struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+type TransferListRequest struct {
+	UserID int64 `json:"user_id"`
+}
+
+// GetListAccess busca a lista e o papel do usuário nela. O papel vem vazio
+// quando o usuário não tem acesso.
+func (r *pgxRepository) GetListAccess(ctx context.Context, listID, userID int64) (ShoppingList, ListRole, error) {
+	query := `SELECT sl.id, sl.user_id, sl.name, sl.created_at,
+				CASE WHEN sl.user_id = $2 THEN 'owner' ELSE COALESCE(m.role, '') END
+			FROM shopping_lists sl
+			LEFT JOIN shopping_list_members m ON m.list_id = sl.id AND m.user_id = $2
+			WHERE sl.id = $1`
+
+	var list ShoppingList
+
+	err := r.db.QueryRow(ctx, query, listID, userID).Scan(&list.ID, &list.UserID, &list.Name, &list.CreatedAt, &list.Role)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ShoppingList{}, "", ErrShoppingListNotFound
+		}
+		return ShoppingList{}, "", err
+	}
+
+	return list, list.Role, nil
+}
+
+// ListMembers devolve o dono e os colaboradores, com o dono primeiro.
+func (r *pgxRepository) ListMembers(ctx context.Context, listID int64) ([]ListMember, error) {
+	query := `SELECT user_id, name, email, role, added_at FROM (
+				SELECT u.id AS user_id, u.name, u.email, 'owner' AS role, sl.created_at AS added_at
+				FROM shopping_lists sl
+				JOIN users u ON u.id = sl.user_id
+				WHERE sl.id = $1
+				UNION ALL
+				SELECT u.id, u.name, u.email, m.role, m.added_at
+				FROM shopping_list_members m
+				JOIN users u ON u.id = m.user_id
+				WHERE m.list_id = $1
+			) members
+			ORDER BY role = 'owner' DESC, name, user_id`
+
+	rows, err := r.db.Query(ctx, query, listID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	members := make([]ListMember, 0)
+
+	for rows.Next() {
+		var m ListMember
+		if err := rows.Scan(&m.UserID, &m.Name, &m.Email, &m.Role, &m.AddedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// ShareByEmail muda o papel de quem já participa da lista; para os demais
+// e-mails cria (ou atualiza) um convite, sem consultar se há conta com ele.
+func (r *pgxRepository) ShareByEmail(ctx context.Context, list ShoppingList, email string, role ListRole, invitedBy int64) (ShareResult, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return ShareResult{}, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	var isOwner bool
+	err = tx.QueryRow(ctx, `SELECT lower(email) = lower($2) FROM users WHERE id = $1`, list.UserID, email).Scan(&isOwner)
+	if err != nil {
+		return ShareResult{}, err
+	}
+	if isOwner {
+		return ShareResult{}, ErrCannotShareWithOwner
+	}
+
+	query := `UPDATE shopping_list_members m SET role = $3
+			FROM users u
+			WHERE m.list_id = $1 AND m.user_id = u.id AND lower(u.email) = lower($2)
+			RETURNING u.id, u.name, u.email, m.role, m.added_at`
+
+	var m ListMember
+	err = tx.QueryRow(ctx, query, list.ID, email, role).Scan(&m.UserID, &m.Name, &m.Email, &m.Role, &m.AddedAt)
+	switch {
+	case err == nil:
+		if err = tx.Commit(ctx); err != nil {
+			return ShareResult{}, err
+		}
+		return ShareResult{Member: &m}, nil
+	case !errors.Is(err, pgx.ErrNoRows):
+		return ShareResult{}, err
+	}
+
+	query = `INSERT INTO shopping_list_invitations (list_id, email, role, invited_by)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (list_id, (lower(email))) DO UPDATE
+			SET role = EXCLUDED.role, invited_by = EXCLUDED.invited_by, created_at = NOW()
+			RETURNING id, created_at`
+
+	inv := ListInvitation{ListID: list.ID, ListName: list.Name, Email: email, Role: role, InvitedBy: &invitedBy}
+	err = tx.QueryRow(ctx, query, list.ID, email, role, invitedBy).Scan(&inv.ID, &inv.CreatedAt)
+	if err != nil {
+		return ShareResult{}, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return ShareResult{}, err
+	}
+
+	return ShareResult{Invitation: &inv}, nil
+}
+
+// ListInvitations devolve os convites pendentes de uma lista.
+func (r *pgxRepository) ListInvitations(ctx context.Context, listID int64) ([]ListInvitation, error) {
+	query := `SELECT i.id, i.list_id, sl.name, i.email, i.role, i.invited_by, i.created_at
+			FROM shopping_list_invitations i
+			JOIN shopping_lists sl ON sl.id = i.list_id
+			WHERE i.list_id = $1
+			ORDER BY i.created_at DESC, i.id DESC`
+
+	return r.queryInvitations(ctx, query, listID)
+}
+
+// ListUserInvitations devolve os convites enviados para o e-mail do usuário.
+func (r *pgxRepository) ListUserInvitations(ctx context.Context, userID int64) ([]ListInvitation, error) {
+	query := `SELECT i.id, i.list_id, sl.name, i.email, i.role, i.invited_by, i.created_at
+			FROM shopping_list_invitations i
+			JOIN shopping_lists sl ON sl.id = i.list_id
+			JOIN users u ON lower(u.email) = lower(i.email)
+			WHERE u.id = $1
+			ORDER BY i.created_at DESC, i.id DESC`
+
+	return r.queryInvitations(ctx, query, userID)
+}
+
+func (r *pgxRepository) queryInvitations(ctx context.Context, query string, args ...any) ([]ListInvitation, error) {
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	invitations := make([]ListInvitation, 0)
+
+	for rows.Next() {
+		var inv ListInvitation
+		err := rows.Scan(&inv.ID, &inv.ListID, &inv.ListName, &inv.Email, &inv.Role, &inv.InvitedBy, &inv.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, inv)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return invitations, nil
+}
+
+// AcceptInvitation transforma o convite enviado ao e-mail do usuário em
+// acesso à lista. O e-mail precisa estar confirmado, para ninguém aceitar
+// convites cadastrando o e-mail de outra pessoa.
+func (r *pgxRepository) AcceptInvitation(ctx context.Context, invitationID, userID int64) (ShoppingList, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return ShoppingList{}, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	query := `SELECT i.list_id, i.role, i.invited_by, u.email_verified_at IS NOT NULL
+			FROM shopping_list_invitations i
+			JOIN users u ON lower(u.email) = lower(i.email)
+			WHERE i.id = $1 AND u.id = $2
+			FOR UPDATE OF i`
+
+	var listID int64
+	var role ListRole
+	var invitedBy *int64
+	var verified bool
+	err = tx.QueryRow(ctx, query, invitationID, userID).Scan(&listID, &role, &invitedBy, &verified)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ShoppingList{}, ErrInvitationNotFound
+		}
+		return ShoppingList{}, err
+	}
+	if !verified {
+		return ShoppingList{}, ErrEmailNotVerified
+	}
+
+	var list ShoppingList
+	err = tx.QueryRow(ctx, `SELECT id, user_id, name, created_at FROM shopping_lists WHERE id = $1`, listID).
+		Scan(&list.ID, &list.UserID, &list.Name, &list.CreatedAt)
+	if err != nil {
+		return ShoppingList{}, err
+	}
+
+	// A lista pode ter sido transferida para o próprio convidado
+	list.Role = ListRoleOwner
+	if list.UserID != userID {
+		_, err = tx.Exec(ctx, `INSERT INTO shopping_list_members (list_id, user_id, role, added_by)
+				VALUES ($1, $2, $3, $4)
+				ON CONFLICT (list_id, user_id) DO UPDATE SET role = EXCLUDED.role`,
+			listID, userID, role, invitedBy)
+		if err != nil {
+			return ShoppingList{}, err
+		}
+		list.Role = role
+	}
+
+	if _, err = tx.Exec(ctx, `DELETE FROM shopping_list_invitations WHERE id = $1`, invitationID); err != nil {
+		return ShoppingList{}, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return ShoppingList{}, err
+	}
+
+	return list, nil
+}
+
+// DeclineInvitation apaga um convite enviado ao e-mail do usuário.
+func (r *pgxRepository) DeclineInvitation(ctx context.Context, invitationID, userID int64) error {
+	query := `DELETE FROM shopping_list_invitations i
+			USING users u
+			WHERE i.id = $1 AND u.id = $2 AND lower(u.email) = lower(i.email)`
+
+	tag, err := r.db.Exec(ctx, query, invitationID, userID)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrInvitationNotFound
+	}
+
+	return nil
+}
+
+// RevokeInvitation cancela um convite da lista.
+func (r *pgxRepository) RevokeInvitation(ctx context.Context, listID, invitationID int64) error {
+	tag, err := r.db.Exec(ctx, `DELETE FROM shopping_list_invitations WHERE id = $1 AND list_id = $2`, invitationID, listID)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrInvitationNotFound
+	}
+
+	return nil
+}
+
+func (r *pgxRepository) RemoveMember(ctx context.Context, listID, userID int64) error {
+	tag, err := r.db.Exec(ctx, `DELETE FROM shopping_list_members WHERE list_id = $1 AND user_id = $2`, listID, userID)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrMemberNotFound
+	}
+
+	return nil
+}
+
+// TransferOwnership passa a lista para um colaborador. O antigo dono continua
+// na lista como editor.
+func (r *pgxRepository) TransferOwnership(ctx context.Context, listID, fromUserID, toUserID int64) (ShoppingList, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return ShoppingList{}, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	var ownerID int64
+	err = tx.QueryRow(ctx, `SELECT user_id FROM shopping_lists WHERE id = $1 FOR UPDATE`, listID).Scan(&ownerID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ShoppingList{}, ErrShoppingListNotFound
+		}
+		return ShoppingList{}, err
+	}
+	if ownerID != fromUserID {
+		return ShoppingList{}, ErrNotListOwner
+	}
+
+	tag, err := tx.Exec(ctx, `DELETE FROM shopping_list_members WHERE list_id = $1 AND user_id = $2`, listID, toUserID)
+	if err != nil {
+		return ShoppingList{}, err
+	}
+	if tag.RowsAffected() == 0 {
+		return ShoppingList{}, ErrMemberNotFound
+	}
+
+	var list ShoppingList
+	err = tx.QueryRow(ctx,
+		`UPDATE shopping_lists SET user_id = $2 WHERE id = $1 RETURNING id, user_id, name, created_at`,
+		listID, toUserID,
+	).Scan(&list.ID, &list.UserID, &list.Name, &list.CreatedAt)
+	if err != nil {
+		return ShoppingList{}, err
+	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO shopping_list_members (list_id, user_id, role, added_by) VALUES ($1, $2, $3, $4)`,
+		listID, fromUserID, ListRoleEditor, toUserID)
+	if err != nil {
+		return ShoppingList{}, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return ShoppingList{}, err
+	}
+
+	list.Role = ListRoleEditor
+	return list, nil
+}
+
+// authorize busca a lista e confere se o papel do usuário basta para a ação.
+func (s *shoppingService) authorize(ctx context.Context, userID, listID int64, need ListRole) (ShoppingList, error) {
+	list, role, err := s.repo.GetListAccess(ctx, listID, userID)
+	if err != nil {
+		return ShoppingList{}, err
+	}
+
+	switch {
+	case role == "":
+		return ShoppingList{}, ErrListAccessDenied
+	case role.allows(need):
+		return list, nil
+	case need == ListRoleOwner:
+		return ShoppingList{}, ErrNotListOwner
+	default:
+		return ShoppingList{}, ErrListReadOnly
+	}
+}
+
+func (s *shoppingService) ListMembers(ctx context.Context, userID, listID int64) ([]ListMember, error) {
+	if _, err := s.authorize(ctx, userID, listID, ListRoleViewer); err != nil {
+		return nil, err
+	}
+
+	return s.repo.ListMembers(ctx, listID)
+}
+
+// ShareList muda o papel de quem já participa ou convida o e-mail para a
+// lista. O convite é enviado por e-mail e vale quando o convidado, já com
+// conta, o aceita.
+func (s *shoppingService) ShareList(ctx context.Context, userID, listID int64, req ShareListRequest) (ShareResult, error) {
+	address, err := mail.ParseAddress(strings.TrimSpace(req.Email))
+	if err != nil || address.Name != "" {
+		return ShareResult{}, ErrInvalidInviteEmail
+	}
+
+	role := ListRole(strings.ToLower(strings.TrimSpace(req.Role)))
+	if role != ListRoleEditor && role != ListRoleViewer {
+		return ShareResult{}, ErrInvalidListRole
+	}
+
+	list, err := s.authorize(ctx, userID, listID, ListRoleOwner)
+	if err != nil {
+		return ShareResult{}, err
+	}
+
+	result, err := s.repo.ShareByEmail(ctx, list, address.Address, role, userID)
+	if err != nil {
+		return ShareResult{}, err
+	}
+
+	if result.Invitation != nil {
+		// O convite já está gravado; uma falha no e-mail só vai para o log
+		if err := s.sendInvitation(ctx, *result.Invitation); err != nil {
+			log.Printf("Erro ao enviar o convite %d da lista %d: %v", result.Invitation.ID, listID, err)
+		}
+	}
+
+	return result, nil
+}
+
+func (s *shoppingService) sendInvitation(ctx context.Context, inv ListInvitation) error {
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      inv.Email,
+		Subject: fmt.Sprintf("Convite para a lista de compras %s", inv.ListName),
+		Body: fmt.Sprintf("Olá!\n\nVocê foi convidado para a lista de compras %q no Localiza Compra, como %s.\n\nPara aceitar, entre (ou crie uma conta) com este e-mail e abra:\n\n%s/listas/convites\n",
+			inv.ListName, inv.Role, s.appURL),
+	})
+}
+
+// ListInvitations lista os convites pendentes, só para o dono da lista.
+func (s *shoppingService) ListInvitations(ctx context.Context, userID, listID int64) ([]ListInvitation, error) {
+	if _, err := s.authorize(ctx, userID, listID, ListRoleOwner); err != nil {
+		return nil, err
+	}
+
+	return s.repo.ListInvitations(ctx, listID)
+}
+
+func (s *shoppingService) RevokeInvitation(ctx context.Context, userID, listID, invitationID int64) error {
+	if _, err := s.authorize(ctx, userID, listID, ListRoleOwner); err != nil {
+		return err
+	}
+
+	return s.repo.RevokeInvitation(ctx, listID, invitationID)
+}
+
+func (s *shoppingService) ListUserInvitations(ctx context.Context, userID int64) ([]ListInvitation, error) {
+	return s.repo.ListUserInvitations(ctx, userID)
+}
+
+func (s *shoppingService) AcceptInvitation(ctx context.Context, userID, invitationID int64) (ShoppingList, error) {
+	return s.repo.AcceptInvitation(ctx, invitationID, userID)
+}
+
+func (s *shoppingService) DeclineInvitation(ctx context.Context, userID, invitationID int64) error {
+	return s.repo.DeclineInvitation(ctx, invitationID, userID)
+}
+
+// RemoveMember tira o acesso de um colaborador. O dono remove qualquer um; o
+// colaborador só pode remover a si mesmo, saindo da lista.
+func (s *shoppingService) RemoveMember(ctx context.Context, userID, listID, memberID int64) error {
+	need := ListRoleOwner
+	if memberID == userID {
+		need = ListRoleViewer
+	}
+
+	list, err := s.authorize(ctx, userID, listID, need)
+	if err != nil {
+		return err
+	}
+	if memberID == list.UserID {
+		return ErrOwnerCannotLeave
+	}
+
+	if err := s.repo.RemoveMember(ctx, listID, memberID); err != nil {
+		return err
+	}
+
+	// Quem saiu da lista deixa de receber os eventos dela
+	s.events.Publish(Event{Type: EventMemberRemoved, ListID: listID, ActorID: userID, UserID: memberID})
+	return nil
+}
+
+func (s *shoppingService) TransferOwnership(ctx context.Context, userID, listID, newOwnerID int64) (ShoppingList, error) {
+	if _, err := s.authorize(ctx, userID, listID, ListRoleOwner); err != nil {
+		return ShoppingList{}, err
+	}
+	if newOwnerID == userID {
+		return ShoppingList{}, ErrCannotShareWithOwner
+	}
+
+	return s.repo.TransferOwnership(ctx, listID, userID, newOwnerID)
+}
@@ -3,47 +3,96 @@ package shoppinglist
 import (
 	"context"
 	"errors"
+	"localiza-compra/backend/internal/api/pagination"
+	"localiza-compra/backend/internal/api/product"
+	"localiza-compra/backend/internal/api/store"
 	"time"
 )
 
 var ErrShoppingListNotFound = errors.New("lista não encontrada")
 var ErrShoppingListItemNotFound = errors.New("produto não encontrado")
 
+var (
+	ErrNotListOwner    = errors.New("não autorizado: você não é o dono desta lista")
+	ErrInvalidListName = errors.New("o nome da lista não pode ser vazio")
+	ErrInvalidQuantity = errors.New("a quantidade precisa ser maior que zero")
+	ErrNothingToUpdate = errors.New("informe is_checked, quantity ou note")
+)
+
+// Tamanho máximo do nome de um item em texto livre
+const maxItemNameLength = 255
+
+var (
+	ErrItemNameRequired  = errors.New("informe o produto ou o nome do item")
+	ErrItemNameTooLong   = errors.New("o nome do item pode ter no máximo 255 caracteres")
+	ErrItemAlreadyLinked = errors.New("o item já está vinculado a um produto")
+)
+
 type ShoppingList struct {
 	ID        int64     `json:"id"`
 	UserID    int64     `json:"user_id"`
 	Name      string    `json:"name"`
 	CreatedAt time.Time `json:"created_at"`
 	ItemCount int       `json:"item_count"`
+	// Papel de quem fez a requisição: owner, editor ou viewer
+	Role ListRole `json:"role,omitempty"`
 }
 
+// ShoppingListItem é um produto do catálogo ou, com ProductID nulo, um item
+// em texto livre que ainda pode ser vinculado a um produto.
 type ShoppingListItem struct {
-	ID             int64 `json:"id"`
-	ShoppingListID int64 `json:"shopping_list_id"`
-	ProductID      int64 `json:"product_id"`
-	Quantity       int   `json:"quantity"`
-	IsChecked      bool  `json:"is_checked"`
+	ID             int64   `json:"id"`
+	ShoppingListID int64   `json:"shopping_list_id"`
+	ProductID      *int64  `json:"product_id"`
+	Name           *string `json:"name,omitempty"`
+	Note           *string `json:"note,omitempty"`
+	Quantity       int     `json:"quantity"`
+	IsChecked      bool    `json:"is_checked"`
+	// Barcode só é usado para encontrar o produto quando ProductID não vem
+	Barcode string `json:"-"`
 }
 
+// CreateShoppingListItemRequest aceita o produto pelo ID ou pelo código de
+// barras. Sem nenhum dos dois, name cria um item em texto livre.
 type CreateShoppingListItemRequest struct {
-	ProductID int64 `json:"product_id"`
-	Quantity  int   `json:"quantity"`
+	ProductID int64  `json:"product_id"`
+	Barcode   string `json:"barcode,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Note      string `json:"note,omitempty"`
+	Quantity  int    `json:"quantity"`
+}
+
+// LinkItemRequest vincula um item em texto livre a um produto, pelo ID ou
+// pelo código de barras.
+type LinkItemRequest struct {
+	ProductID int64  `json:"product_id"`
+	Barcode   string `json:"barcode,omitempty"`
 }
 
 type CreateShoppingListRequest struct {
 	Name string `json:"name"`
 }
 
+type RenameShoppingListRequest struct {
+	Name string `json:"name"`
+}
+
+// ListItemDetail traz o nome do produto ou, nos itens sem produto, o texto
+// digitado pelo usuário.
 type ListItemDetail struct {
-	ID        int64  `json:"id"`
-	ProductID int64  `json:"product_id"`
-	Name      string `json:"product_name"`
-	Quantity  int    `json:"quantity"`
-	IsChecked bool   `json:"is_checked"`
+	ID        int64   `json:"id"`
+	ProductID *int64  `json:"product_id"`
+	Name      string  `json:"product_name"`
+	Note      *string `json:"note"`
+	Quantity  int     `json:"quantity"`
+	IsChecked bool    `json:"is_checked"`
 }
 
+// UpdateItemRequest muda só os campos enviados. Note vazia apaga a observação.
 type UpdateItemRequest struct {
-	IsChecked bool `json:"is_checked"`
+	IsChecked *bool   `json:"is_checked"`
+	Quantity  *int    `json:"quantity"`
+	Note      *string `json:"note"`
 }
 
 type OptimizedListItem struct {
@@ -55,21 +104,148 @@ type OptimizedListItem struct {
 	Sector      string  `json:"sector"`
 }
 
+// UnlinkedItem é um item em texto livre. Sem produto não há preço, então os
+// otimizadores o devolvem à parte em vez de descartá-lo.
+type UnlinkedItem struct {
+	ItemID    int64   `json:"item_id"`
+	Name      string  `json:"name"`
+	Note      *string `json:"note"`
+	Quantity  int     `json:"quantity"`
+	IsChecked bool    `json:"is_checked"`
+}
+
+// OptimizedList é a lista no percurso da loja, com os itens sem produto à parte.
+type OptimizedList struct {
+	Items         []OptimizedListItem `json:"items"`
+	UnlinkedItems []UnlinkedItem      `json:"unlinked_items"`
+}
+
+// StoreItemPrice é uma linha do cruzamento entre os itens da lista e o estoque de uma loja.
+// Price fica nulo quando a loja não vende o produto.
+type StoreItemPrice struct {
+	StoreID     int64
+	StoreName   string
+	ProductID   int64
+	ProductName string
+	Quantity    int
+	Price       *float64
+}
+
+type MissingItem struct {
+	ProductID   int64  `json:"product_id"`
+	ProductName string `json:"product_name"`
+	Quantity    int    `json:"quantity"`
+}
+
+type StoreComparison struct {
+	StoreID      int64         `json:"store_id"`
+	StoreName    string        `json:"store_name"`
+	Total        float64       `json:"total"`
+	ItemsCovered int           `json:"items_covered"`
+	ItemsTotal   int           `json:"items_total"`
+	MissingItems []MissingItem `json:"missing_items"`
+	// Itens em texto livre, que não entram em ItemsTotal
+	UnlinkedItems []UnlinkedItem `json:"unlinked_items"`
+}
+
+// StockOffer é um item da lista disponível numa loja com estoque suficiente.
+type StockOffer struct {
+	ItemID      int64
+	ProductID   int64
+	ProductName string
+	Quantity    int
+	StoreID     int64
+	StoreName   string
+	Price       float64
+	Sector      string
+}
+
+type SplitItem struct {
+	ProductID   int64   `json:"product_id"`
+	ProductName string  `json:"product_name"`
+	Quantity    int     `json:"quantity"`
+	UnitPrice   float64 `json:"unit_price"`
+	Subtotal    float64 `json:"subtotal"`
+	Sector      string  `json:"sector"`
+}
+
+type StoreBasket struct {
+	StoreID   int64       `json:"store_id"`
+	StoreName string      `json:"store_name"`
+	Items     []SplitItem `json:"items"`
+	Subtotal  float64     `json:"subtotal"`
+}
+
+// SplitBasket é a divisão da lista entre lojas. Saving é a diferença para a
+// melhor loja única; pode ser negativa quando a divisão cobre mais itens.
+type SplitBasket struct {
+	Stores          []StoreBasket  `json:"stores"`
+	GrandTotal      float64        `json:"grand_total"`
+	MissingItems    []MissingItem  `json:"missing_items"`
+	UnlinkedItems   []UnlinkedItem `json:"unlinked_items"`
+	BestSingleStore *StoreBasket   `json:"best_single_store"`
+	Saving          float64        `json:"saving"`
+}
+
 type Repository interface {
 	CreateList(ctx context.Context, list ShoppingList) (ShoppingList, error)
-	CreateItem(ctx context.Context, item ShoppingListItem) (ShoppingListItem, error)
+	CreateItem(ctx context.Context, item ShoppingListItem) (ShoppingListItem, bool, error)
+	RenameList(ctx context.Context, listID int64, name string) (ShoppingList, error)
+	DeleteList(ctx context.Context, listID int64) error
 	GetShoppingListByID(ctx context.Context, id int64) (ShoppingList, error)
-	GetAllByUserID(ctx context.Context, userID int64) ([]ShoppingList, error)
+	GetListAccess(ctx context.Context, listID, userID int64) (ShoppingList, ListRole, error)
+	GetAllByUserID(ctx context.Context, userID int64, params pagination.Params) ([]ShoppingList, int, error)
 	GetAllItemsByListID(ctx context.Context, listID int64) ([]ListItemDetail, error)
-	UpdateItemStatus(ctx context.Context, itemID int64, isChecked bool) error
+	GetItem(ctx context.Context, listID, itemID int64) (ShoppingListItem, error)
+	LinkItem(ctx context.Context, listID, itemID, productID int64) (ShoppingListItem, bool, error)
+	UpdateItem(ctx context.Context, listID, itemID int64, req UpdateItemRequest) (ShoppingListItem, error)
+	DeleteItem(ctx context.Context, listID, itemID int64) error
 	GetOptimizedList(ctx context.Context, listID int64, storeID int64) ([]OptimizedListItem, error)
+	GetUnlinkedItems(ctx context.Context, listID int64) ([]UnlinkedItem, error)
+	GetListPricesByStores(ctx context.Context, listID int64, storeIDs []int64) ([]StoreItemPrice, error)
+	GetStockOffers(ctx context.Context, listID int64, storeIDs []int64) ([]StockOffer, error)
+
+	ListMembers(ctx context.Context, listID int64) ([]ListMember, error)
+	ShareByEmail(ctx context.Context, list ShoppingList, email string, role ListRole, invitedBy int64) (ShareResult, error)
+	ListInvitations(ctx context.Context, listID int64) ([]ListInvitation, error)
+	ListUserInvitations(ctx context.Context, userID int64) ([]ListInvitation, error)
+	AcceptInvitation(ctx context.Context, invitationID, userID int64) (ShoppingList, error)
+	DeclineInvitation(ctx context.Context, invitationID, userID int64) error
+	RevokeInvitation(ctx context.Context, listID, invitationID int64) error
+	RemoveMember(ctx context.Context, listID, userID int64) error
+	TransferOwnership(ctx context.Context, listID, fromUserID, toUserID int64) (ShoppingList, error)
 }
 
 type Service interface {
 	CreateList(ctx context.Context, list ShoppingList) (ShoppingList, error)
-	CreateItem(ctx context.Context, userID int64, item ShoppingListItem) (ShoppingListItem, error)
-	GetAllByUserID(ctx context.Context, userID int64) ([]ShoppingList, error)
+	CreateItem(ctx context.Context, userID int64, item ShoppingListItem) (ShoppingListItem, bool, error)
+	RenameList(ctx context.Context, userID, listID int64, name string) (ShoppingList, error)
+	DeleteList(ctx context.Context, userID, listID int64) error
+	GetAllByUserID(ctx context.Context, userID int64, params pagination.Params) (pagination.Page[ShoppingList], error)
 	GetAllItemsByListID(ctx context.Context, userID, listID int64) ([]ListItemDetail, error)
-	UpdateItemStatus(ctx context.Context, userID, listID, itemID int64, isChecked bool) error
-	GetOptimizedList(ctx context.Context, userID, listID, storeID int64) ([]OptimizedListItem, error)
+	UpdateItem(ctx context.Context, userID, listID, itemID int64, req UpdateItemRequest) error
+	DeleteItem(ctx context.Context, userID, listID, itemID int64) error
+	LinkItem(ctx context.Context, userID, listID, itemID int64, req LinkItemRequest) (ShoppingListItem, bool, error)
+	SuggestProducts(ctx context.Context, userID, listID, itemID int64, limit int) ([]product.SearchHit, error)
+	GetOptimizedList(ctx context.Context, userID, listID, storeID int64) (OptimizedList, error)
+	CompareStores(ctx context.Context, userID, listID int64, storeIDs []int64, area *store.NearbyQuery) ([]StoreComparison, error)
+	SplitBasket(ctx context.Context, userID, listID int64, maxStores int, area *store.NearbyQuery) (SplitBasket, error)
+
+	ListMembers(ctx context.Context, userID, listID int64) ([]ListMember, error)
+	ShareList(ctx context.Context, userID, listID int64, req ShareListRequest) (ShareResult, error)
+	ListInvitations(ctx context.Context, userID, listID int64) ([]ListInvitation, error)
+	RevokeInvitation(ctx context.Context, userID, listID, invitationID int64) error
+	ListUserInvitations(ctx context.Context, userID int64) ([]ListInvitation, error)
+	AcceptInvitation(ctx context.Context, userID, invitationID int64) (ShoppingList, error)
+	DeclineInvitation(ctx context.Context, userID, invitationID int64) error
+	RemoveMember(ctx context.Context, userID, listID, memberID int64) error
+	TransferOwnership(ctx context.Context, userID, listID, newOwnerID int64) (ShoppingList, error)
+
+	Subscribe(ctx context.Context, userID, listID, lastEventID int64) (Subscription, error)
+}
+
+// StoreLocator encontra as lojas dentro de um raio, para limitar as lojas
+// candidatas do otimizador. É implementado por store.Service.
+type StoreLocator interface {
+	NearbyIDs(ctx context.Context, q store.NearbyQuery) ([]int64, error)
 }
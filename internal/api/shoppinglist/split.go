@@ -0,0 +1,216 @@
+package shoppinglist
+
+import (
+	"math"
+	"sort"
+)
+
+// Acima deste número de combinações de lojas deixamos a busca exaustiva
+// e passamos para a heurística gulosa.
+const maxSplitCombinations = 50000
+
+type splitPlan struct {
+	covered    int
+	total      float64
+	assignment map[int64]StockOffer // itemID -> oferta escolhida
+}
+
+// better diz se a é um plano melhor que b: cobrir mais itens vem antes de custar menos.
+func (a splitPlan) better(b splitPlan) bool {
+	if a.covered != b.covered {
+		return a.covered > b.covered
+	}
+	return a.total < b.total-0.005
+}
+
+// solveSplit escolhe até maxStores lojas e atribui cada item da lista à loja mais
+// barata entre as escolhidas.
+func solveSplit(items []ListItemDetail, offers []StockOffer, maxStores int) SplitBasket {
+	// Para cada item, a oferta mais barata de cada loja
+	offersByItem := make(map[int64]map[int64]StockOffer)
+	storeNames := make(map[int64]string)
+	for _, o := range offers {
+		byStore, ok := offersByItem[o.ItemID]
+		if !ok {
+			byStore = make(map[int64]StockOffer)
+			offersByItem[o.ItemID] = byStore
+		}
+		if current, ok := byStore[o.StoreID]; !ok || o.Price < current.Price {
+			byStore[o.StoreID] = o
+		}
+		storeNames[o.StoreID] = o.StoreName
+	}
+
+	stores := make([]int64, 0, len(storeNames))
+	for id := range storeNames {
+		stores = append(stores, id)
+	}
+	sort.Slice(stores, func(i, j int) bool { return stores[i] < stores[j] })
+
+	evaluate := func(chosen []int64) splitPlan {
+		plan := splitPlan{assignment: make(map[int64]StockOffer)}
+		for _, item := range items {
+			var best *StockOffer
+			for _, storeID := range chosen {
+				o, ok := offersByItem[item.ID][storeID]
+				if ok && (best == nil || o.Price < best.Price) {
+					best = &o
+				}
+			}
+			if best != nil {
+				plan.covered++
+				plan.total += best.Price * float64(best.Quantity)
+				plan.assignment[item.ID] = *best
+			}
+		}
+		return plan
+	}
+
+	k := min(maxStores, len(stores))
+
+	var best splitPlan
+	if countCombinations(len(stores), k) <= maxSplitCombinations {
+		// Acrescentar lojas nunca piora o plano, então basta olhar os conjuntos de tamanho k
+		first := true
+		forEachCombination(stores, k, func(chosen []int64) {
+			plan := evaluate(chosen)
+			if first || plan.better(best) {
+				best = plan
+				first = false
+			}
+		})
+	} else {
+		chosen := make([]int64, 0, k)
+		best = evaluate(chosen)
+		for len(chosen) < k {
+			var pick int64
+			var pickPlan splitPlan
+			found := false
+			for _, storeID := range stores {
+				if containsID(chosen, storeID) {
+					continue
+				}
+				plan := evaluate(append(chosen, storeID))
+				if !found || plan.better(pickPlan) {
+					pick, pickPlan, found = storeID, plan, true
+				}
+			}
+			if !found || !pickPlan.better(best) {
+				break
+			}
+			chosen = append(chosen, pick)
+			best = pickPlan
+		}
+	}
+
+	result := buildSplitBasket(items, best, storeNames)
+
+	// Melhor loja única, para calcular a economia da divisão
+	var single splitPlan
+	var singleStore int64
+	for i, storeID := range stores {
+		plan := evaluate([]int64{storeID})
+		if i == 0 || plan.better(single) {
+			single, singleStore = plan, storeID
+		}
+	}
+	if len(stores) > 0 {
+		singleBasket := buildSplitBasket(items, single, storeNames)
+		if len(singleBasket.Stores) > 0 {
+			result.BestSingleStore = &singleBasket.Stores[0]
+		} else {
+			result.BestSingleStore = &StoreBasket{StoreID: singleStore, StoreName: storeNames[singleStore], Items: make([]SplitItem, 0)}
+		}
+		result.Saving = roundMoney(result.BestSingleStore.Subtotal - result.GrandTotal)
+	}
+
+	return result
+}
+
+func buildSplitBasket(items []ListItemDetail, plan splitPlan, storeNames map[int64]string) SplitBasket {
+	result := SplitBasket{
+		Stores:       make([]StoreBasket, 0),
+		MissingItems: make([]MissingItem, 0),
+	}
+
+	baskets := make(map[int64]*StoreBasket)
+	order := make([]int64, 0)
+	for _, item := range items {
+		o, ok := plan.assignment[item.ID]
+		if !ok {
+			result.MissingItems = append(result.MissingItems, MissingItem{
+				ProductID:   *item.ProductID,
+				ProductName: item.Name,
+				Quantity:    item.Quantity,
+			})
+			continue
+		}
+
+		b, ok := baskets[o.StoreID]
+		if !ok {
+			b = &StoreBasket{StoreID: o.StoreID, StoreName: storeNames[o.StoreID], Items: make([]SplitItem, 0)}
+			baskets[o.StoreID] = b
+			order = append(order, o.StoreID)
+		}
+
+		subtotal := roundMoney(o.Price * float64(o.Quantity))
+		b.Items = append(b.Items, SplitItem{
+			ProductID:   o.ProductID,
+			ProductName: o.ProductName,
+			Quantity:    o.Quantity,
+			UnitPrice:   o.Price,
+			Subtotal:    subtotal,
+			Sector:      o.Sector,
+		})
+		b.Subtotal = roundMoney(b.Subtotal + subtotal)
+	}
+
+	for _, id := range order {
+		result.Stores = append(result.Stores, *baskets[id])
+		result.GrandTotal = roundMoney(result.GrandTotal + baskets[id].Subtotal)
+	}
+
+	return result
+}
+
+func forEachCombination(ids []int64, k int, fn func([]int64)) {
+	chosen := make([]int64, 0, k)
+	var walk func(start int)
+	walk = func(start int) {
+		if len(chosen) == k {
+			fn(chosen)
+			return
+		}
+		for i := start; i <= len(ids)-(k-len(chosen)); i++ {
+			chosen = append(chosen, ids[i])
+			walk(i + 1)
+			chosen = chosen[:len(chosen)-1]
+		}
+	}
+	walk(0)
+}
+
+// countCombinations calcula C(n, k), parando assim que passa do limite da busca exaustiva.
+func countCombinations(n, k int) int {
+	result := 1
+	for i := 1; i <= k; i++ {
+		result = result * (n - k + i) / i
+		if result > maxSplitCombinations {
+			return result
+		}
+	}
+	return result
+}
+
+func containsID(ids []int64, id int64) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+func roundMoney(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -2,9 +2,14 @@ package stock
 
 import (
 	"encoding/json"
+	"errors"
+	"localiza-compra/backend/internal/api/pagination"
+	"localiza-compra/backend/internal/api/product"
 	"log"
+	"mime"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 )
@@ -19,6 +24,35 @@ func NewHandler(s Service) *stockItemHandler {
 	}
 }
 
+// productIDFromRequest lê o produto da rota, seja pelo {productID} ou pelo
+// {barcode}. Em caso de erro a resposta já é escrita e ok volta falso.
+func (h *stockItemHandler) productIDFromRequest(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	if barcode := chi.URLParam(r, "barcode"); barcode != "" {
+		productID, err := h.service.ResolveProductID(r.Context(), barcode)
+		if err != nil {
+			if errors.Is(err, product.ErrInvalidBarcode) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return 0, false
+			}
+			if errors.Is(err, product.ErrProductNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return 0, false
+			}
+			log.Printf("Erro ao buscar produto pelo código de barras: %v", err)
+			http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+			return 0, false
+		}
+		return productID, true
+	}
+
+	productID, err := strconv.ParseInt(chi.URLParam(r, "productID"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID do produto inválido", http.StatusBadRequest)
+		return 0, false
+	}
+	return productID, true
+}
+
 func (h *stockItemHandler) Create(w http.ResponseWriter, r *http.Request) {
 	storeIDParam := chi.URLParam(r, "storeID")
 	storeID, err := strconv.ParseInt(storeIDParam, 10, 64)
@@ -27,10 +61,8 @@ func (h *stockItemHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	productIDParam := chi.URLParam(r, "productID")
-	productID, err := strconv.ParseInt(productIDParam, 10, 64)
-	if err != nil {
-		http.Error(w, "ID do produto inválido", http.StatusBadRequest)
+	productID, ok := h.productIDFromRequest(w, r)
+	if !ok {
 		return
 	}
 
@@ -51,8 +83,17 @@ func (h *stockItemHandler) Create(w http.ResponseWriter, r *http.Request) {
 
 	createdStockItem, err := h.service.Create(r.Context(), stockItemToCreate)
 	if err != nil {
-		log.Printf("Erro ao criar estoque do item.")
+		if errors.Is(err, ErrInvalidStockItem) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, ErrStockItemAlreadyExists) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		log.Printf("Erro ao criar estoque do item: %v", err)
 		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -60,6 +101,22 @@ func (h *stockItemHandler) Create(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(createdStockItem)
 }
 
+// listOptions define a ordenação e os filtros aceitos em GET /stores/{storeID}/products
+var listOptions = pagination.Options{
+	Sorts: map[string]string{
+		"name":     "products.name",
+		"price":    "stock_items.price",
+		"quantity": "stock_items.quantity",
+		"sector":   "stock_items.sector",
+	},
+	DefaultSort: "name",
+	Tiebreaker:  "products.id",
+	Filters: map[string]pagination.Filter{
+		"name":   {Column: "products.name", Kind: pagination.FilterContains},
+		"sector": {Column: "stock_items.sector", Kind: pagination.FilterText},
+	},
+}
+
 func (h *stockItemHandler) GetAllByStoreId(w http.ResponseWriter, r *http.Request) {
 	storeIDParam := chi.URLParam(r, "storeID")
 	storeID, err := strconv.ParseInt(storeIDParam, 10, 64)
@@ -68,14 +125,234 @@ func (h *stockItemHandler) GetAllByStoreId(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	productStore, err := h.service.GetAllByStoreId(r.Context(), storeID)
+	params, err := pagination.Parse(r, listOptions)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	productStore, err := h.service.GetAllByStoreId(r.Context(), storeID, params)
 	if err != nil {
 		log.Printf("Erro ao buscar produtos: %v", err)
 		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
 		return
 	}
 
+	productStore.SetLinks(w, r)
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(productStore)
 }
+
+func (h *stockItemHandler) Upsert(w http.ResponseWriter, r *http.Request) {
+	storeID, err := strconv.ParseInt(chi.URLParam(r, "storeID"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID da loja inválido", http.StatusBadRequest)
+		return
+	}
+
+	productID, ok := h.productIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var req CreateStockItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Corpo da requisição inválido", http.StatusBadRequest)
+		return
+	}
+
+	item, created, err := h.service.Upsert(r.Context(), StockItem{
+		StoreID:   storeID,
+		ProductID: productID,
+		Price:     req.Price,
+		Quantity:  req.Quantity,
+		Sector:    req.Sector,
+	})
+	if err != nil {
+		if errors.Is(err, ErrInvalidStockItem) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Erro ao salvar estoque do item: %v", err)
+		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(item)
+}
+
+func (h *stockItemHandler) PartialUpdate(w http.ResponseWriter, r *http.Request) {
+	storeID, err := strconv.ParseInt(chi.URLParam(r, "storeID"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID da loja inválido", http.StatusBadRequest)
+		return
+	}
+
+	productID, ok := h.productIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var req UpdateStockItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Corpo da requisição inválido", http.StatusBadRequest)
+		return
+	}
+
+	err = h.service.PartialUpdate(r.Context(), storeID, productID, req)
+	if err != nil {
+		if errors.Is(err, ErrInvalidStockItem) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, ErrStockItemNotFount) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		log.Printf("Erro ao atualizar estoque do item: %v", err)
+		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *stockItemHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	storeID, err := strconv.ParseInt(chi.URLParam(r, "storeID"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID da loja inválido", http.StatusBadRequest)
+		return
+	}
+
+	productID, ok := h.productIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	err = h.service.Delete(r.Context(), storeID, productID)
+	if err != nil {
+		if errors.Is(err, ErrStockItemNotFount) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		log.Printf("Erro ao remover estoque do item: %v", err)
+		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetPriceHistory devolve a série de preços de um produto. Aceita ?storeID= para
+// limitar a uma loja e ?from=/?to= (AAAA-MM-DD); por padrão, os últimos 90 dias.
+func (h *stockItemHandler) GetPriceHistory(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.ParseInt(chi.URLParam(r, "productID"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID do produto inválido", http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+
+	var storeID *int64
+	if param := query.Get("storeID"); param != "" {
+		id, err := strconv.ParseInt(param, 10, 64)
+		if err != nil {
+			http.Error(w, "ID da loja inválido", http.StatusBadRequest)
+			return
+		}
+		storeID = &id
+	}
+
+	to := time.Now()
+	if param := query.Get("to"); param != "" {
+		day, err := time.Parse(time.DateOnly, param)
+		if err != nil {
+			http.Error(w, "Data final inválida, use AAAA-MM-DD", http.StatusBadRequest)
+			return
+		}
+		// Inclui o dia inteiro
+		to = day.Add(24*time.Hour - time.Nanosecond)
+	}
+
+	from := to.AddDate(0, 0, -90)
+	if param := query.Get("from"); param != "" {
+		from, err = time.Parse(time.DateOnly, param)
+		if err != nil {
+			http.Error(w, "Data inicial inválida, use AAAA-MM-DD", http.StatusBadRequest)
+			return
+		}
+	}
+
+	history, err := h.service.GetPriceHistory(r.Context(), productID, storeID, from, to)
+	if err != nil {
+		if errors.Is(err, ErrInvalidPeriod) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Erro ao buscar histórico de preços: %v", err)
+		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(history)
+}
+
+// Limite do corpo da importação em massa
+const maxImportSize = 10 << 20
+
+// Import recebe um CSV (text/csv) ou JSON (application/json) com as linhas de
+// estoque da loja. Com ?dryRun=true apenas valida, sem gravar nada.
+func (h *stockItemHandler) Import(w http.ResponseWriter, r *http.Request) {
+	storeID, err := strconv.ParseInt(chi.URLParam(r, "storeID"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID da loja inválido", http.StatusBadRequest)
+		return
+	}
+
+	dryRun := false
+	if param := r.URL.Query().Get("dryRun"); param != "" {
+		dryRun, err = strconv.ParseBool(param)
+		if err != nil {
+			http.Error(w, "dryRun precisa ser true ou false", http.StatusBadRequest)
+			return
+		}
+	}
+
+	format := "json"
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err == nil && mediaType == "text/csv" {
+		format = "csv"
+	}
+
+	rows, err := ParseImport(http.MaxBytesReader(w, r.Body, maxImportSize), format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.service.Import(r.Context(), storeID, rows, dryRun)
+	if err != nil {
+		if errors.Is(err, ErrInvalidImportFile) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Erro ao importar estoque: %v", err)
+		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(report)
+}
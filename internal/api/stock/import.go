@@ -0,0 +1,231 @@
+package stock
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	ImportStatusCreated  = "created"
+	ImportStatusUpdated  = "updated"
+	ImportStatusRejected = "rejected"
+)
+
+var ErrInvalidImportFile = errors.New("arquivo de importação inválido")
+
+// ImportRow é uma linha do arquivo de importação. Error vem preenchido quando a
+// linha nem chegou a ser lida corretamente.
+type ImportRow struct {
+	Line      int
+	ProductID int64
+	Barcode   string
+	Price     float64
+	Quantity  int
+	Sector    string
+	Error     string
+}
+
+type ImportRowResult struct {
+	Line      int    `json:"line"`
+	ProductID int64  `json:"product_id,omitempty"`
+	Barcode   string `json:"barcode,omitempty"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+}
+
+type ImportReport struct {
+	DryRun   bool              `json:"dry_run"`
+	Created  int               `json:"created"`
+	Updated  int               `json:"updated"`
+	Rejected int               `json:"rejected"`
+	Rows     []ImportRowResult `json:"rows"`
+}
+
+type importJSONRow struct {
+	ProductID *int64   `json:"product_id"`
+	Barcode   string   `json:"barcode"`
+	Price     *float64 `json:"price"`
+	Quantity  *int     `json:"quantity"`
+	Sector    string   `json:"sector"`
+}
+
+// ParseImport lê as linhas no formato indicado ("csv" ou "json").
+func ParseImport(r io.Reader, format string) ([]ImportRow, error) {
+	switch format {
+	case "csv":
+		return ParseImportCSV(r)
+	case "json":
+		return ParseImportJSON(r)
+	default:
+		return nil, fmt.Errorf("%w: formato %q não suportado, use csv ou json", ErrInvalidImportFile, format)
+	}
+}
+
+// ParseImportJSON lê uma lista de objetos com product_id ou barcode, price,
+// quantity e sector.
+func ParseImportJSON(r io.Reader) ([]ImportRow, error) {
+	var raw []importJSONRow
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImportFile, err)
+	}
+
+	rows := make([]ImportRow, 0, len(raw))
+	for i, item := range raw {
+		row := ImportRow{
+			Line:    i + 1,
+			Barcode: strings.TrimSpace(item.Barcode),
+			Sector:  strings.TrimSpace(item.Sector),
+		}
+		if item.ProductID != nil {
+			row.ProductID = *item.ProductID
+		}
+		switch {
+		case item.Price == nil:
+			row.Error = "preço não informado"
+		case item.Quantity == nil:
+			row.Error = "quantidade não informada"
+		default:
+			row.Price = *item.Price
+			row.Quantity = *item.Quantity
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// ParseImportCSV lê um CSV com cabeçalho. As colunas reconhecidas são
+// product_id, barcode, price, quantity e sector; o separador pode ser vírgula
+// ou ponto e vírgula, e o preço segue as regras de parsePrice.
+func ParseImportCSV(r io.Reader) ([]ImportRow, error) {
+	br := bufio.NewReader(r)
+	firstLine, err := br.Peek(4096)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return nil, err
+	}
+
+	reader := csv.NewReader(br)
+	header := string(firstLine)
+	if i := strings.IndexByte(header, '\n'); i >= 0 {
+		header = header[:i]
+	}
+	if strings.Contains(header, ";") && !strings.Contains(header, ",") {
+		reader.Comma = ';'
+	}
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	columns, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: cabeçalho ausente", ErrInvalidImportFile)
+	}
+
+	index := make(map[string]int)
+	for i, c := range columns {
+		index[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(c, "\ufeff")))] = i
+	}
+	_, hasProduct := index["product_id"]
+	_, hasBarcode := index["barcode"]
+	if !hasProduct && !hasBarcode {
+		return nil, fmt.Errorf("%w: é preciso uma coluna product_id ou barcode", ErrInvalidImportFile)
+	}
+	for _, required := range []string{"price", "quantity"} {
+		if _, ok := index[required]; !ok {
+			return nil, fmt.Errorf("%w: coluna %s ausente", ErrInvalidImportFile, required)
+		}
+	}
+
+	field := func(record []string, name string) string {
+		i, ok := index[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	rows := make([]ImportRow, 0)
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return nil, err
+			}
+			rows = append(rows, ImportRow{Line: parseErr.StartLine, Error: parseErr.Err.Error()})
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+
+		row := ImportRow{
+			Line:    line,
+			Barcode: field(record, "barcode"),
+			Sector:  field(record, "sector"),
+		}
+
+		if v := field(record, "product_id"); v != "" {
+			row.ProductID, err = strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				row.Error = "ID do produto inválido"
+				rows = append(rows, row)
+				continue
+			}
+		}
+
+		row.Price, err = parsePrice(field(record, "price"))
+		if err != nil {
+			row.Error = "preço inválido"
+			rows = append(rows, row)
+			continue
+		}
+
+		row.Quantity, err = strconv.Atoi(field(record, "quantity"))
+		if err != nil {
+			row.Error = "quantidade inválida"
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+var errInvalidPrice = errors.New("preço inválido")
+
+// parsePrice lê o preço como as planilhas costumam exportar: "12.5", "12,5",
+// "1.234,56" ou "1,234.56". Com os dois separadores, o último é o decimal e o
+// outro separa os milhares; com um só, ele é o decimal. Notação científica,
+// NaN e infinito são recusados.
+func parsePrice(s string) (float64, error) {
+	lastDot, lastComma := strings.LastIndex(s, "."), strings.LastIndex(s, ",")
+	switch {
+	case lastDot >= 0 && lastComma >= 0 && lastComma > lastDot:
+		s = strings.ReplaceAll(s, ".", "")
+		s = strings.Replace(s, ",", ".", 1)
+	case lastDot >= 0 && lastComma >= 0:
+		s = strings.ReplaceAll(s, ",", "")
+	case lastComma >= 0:
+		s = strings.Replace(s, ",", ".", 1)
+	}
+
+	// Depois da troca só podem sobrar dígitos, um ponto e o sinal
+	digits := strings.TrimPrefix(s, "-")
+	if digits == "" || strings.Count(digits, ".") > 1 || strings.Trim(digits, "0123456789.") != "" {
+		return 0, errInvalidPrice
+	}
+
+	price, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(price) || math.IsInf(price, 0) {
+		return 0, errInvalidPrice
+	}
+	return price, nil
+}
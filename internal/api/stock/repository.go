@@ -2,7 +2,14 @@ package stock
 
 import (
 	"context"
+	"errors"
+	"localiza-compra/backend/internal/api/pagination"
+	"log"
+	"time"
 
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -17,9 +24,16 @@ func NewRepository(dbpool *pgxpool.Pool) Repository {
 }
 
 func (r *pgxRepository) Create(ctx context.Context, item StockItem) (StockItem, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return StockItem{}, err
+	}
+
+	defer tx.Rollback(ctx)
+
 	query := `INSERT INTO stock_items (store_id, product_id, price, quantity, sector) VALUES ($1, $2, $3, $4, $5) RETURNING id`
 
-	err := r.db.QueryRow(ctx, query,
+	err = tx.QueryRow(ctx, query,
 		item.StoreID,
 		item.ProductID,
 		item.Price,
@@ -28,46 +42,352 @@ func (r *pgxRepository) Create(ctx context.Context, item StockItem) (StockItem,
 	).Scan(&item.ID)
 
 	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return StockItem{}, ErrStockItemAlreadyExists
+		}
+		return StockItem{}, err
+	}
+
+	if err = recordPriceChange(ctx, tx, item.StoreID, item.ProductID, item.Price); err != nil {
+		return StockItem{}, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
 		return StockItem{}, err
 	}
 
 	return item, nil
 }
 
-func (r *pgxRepository) GetAllByStoreId(ctx context.Context, storeID int64) ([]ProductStockDetail, error) {
-	query := `SELECT
-				products.id,
-				products.name,
-				products.description,
-				stock_items.price,
-				stock_items.quantity
-			FROM stock_items
-			JOIN products ON stock_items.product_id = products.id
-			WHERE stock_items.store_id = $1;`
-
-	rows, err := r.db.Query(ctx, query, storeID)
+func (r *pgxRepository) GetAllByStoreId(ctx context.Context, storeID int64, params pagination.Params) ([]ProductStockDetail, int, error) {
+	base := sq.Select().
+		From("stock_items").
+		Join("products ON stock_items.product_id = products.id").
+		Where(sq.Eq{"stock_items.store_id": storeID}).
+		PlaceholderFormat(sq.Dollar)
+
+	total, err := pagination.Count(ctx, r.db, params.Filter(base.Columns("COUNT(*)")))
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+
+	query, args, err := params.Apply(base.Columns(
+		"products.id",
+		"products.name",
+		"products.description",
+		"stock_items.price",
+		"stock_items.quantity",
+		"stock_items.sector",
+	)).ToSql()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
 	}
 
 	defer rows.Close()
 
-	var productStockDetail []ProductStockDetail
+	productStockDetail := make([]ProductStockDetail, 0)
 
 	for rows.Next() {
 		var p ProductStockDetail
 
-		err := rows.Scan(&p.ProductID, &p.Name, &p.Description, &p.Price, &p.Quantity)
+		err := rows.Scan(&p.ProductID, &p.Name, &p.Description, &p.Price, &p.Quantity, &p.Sector)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 
 		productStockDetail = append(productStockDetail, p)
 	}
 
 	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return productStockDetail, total, nil
+}
+
+// Upsert cria o item de estoque ou atualiza o já existente para o mesmo par
+// (loja, produto). O booleano indica se o registro foi criado.
+func (r *pgxRepository) Upsert(ctx context.Context, item StockItem) (StockItem, bool, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return StockItem{}, false, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	item, created, err := upsertWithTx(ctx, tx, item)
+	if err != nil {
+		return StockItem{}, false, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return StockItem{}, false, err
+	}
+
+	return item, created, nil
+}
+
+// importRowError traduz o erro do banco numa linha da importação. A mensagem
+// do Postgres cita tabelas e restrições, então só vai para o log.
+func importRowError(line int, pgErr *pgconn.PgError) string {
+	switch pgErr.Code {
+	case "23503":
+		return "produto não encontrado"
+	case "23505":
+		return "conflito com um item já cadastrado"
+	case "23514":
+		return "valor fora do permitido"
+	case "22003":
+		return "preço ou quantidade grande demais"
+	default:
+		log.Printf("Erro ao importar a linha %d: %v", line, pgErr)
+		return "linha inválida"
+	}
+}
+
+// Import aplica as linhas numa única transação. Cada linha roda num savepoint
+// próprio, então uma linha com erro é rejeitada sem derrubar as outras. Em
+// dryRun tudo é executado e a transação é desfeita no final.
+func (r *pgxRepository) Import(ctx context.Context, storeID int64, rows []ImportRow, dryRun bool) ([]ImportRowResult, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
 		return nil, err
 	}
 
-	return productStockDetail, nil
+	defer tx.Rollback(ctx)
+
+	results := make([]ImportRowResult, 0, len(rows))
+
+	for _, row := range rows {
+		result := ImportRowResult{Line: row.Line, ProductID: row.ProductID}
+
+		savepoint, err := tx.Begin(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		_, created, err := upsertWithTx(ctx, savepoint, StockItem{
+			StoreID:   storeID,
+			ProductID: row.ProductID,
+			Price:     row.Price,
+			Quantity:  row.Quantity,
+			Sector:    row.Sector,
+		})
+		if err != nil {
+			if rbErr := savepoint.Rollback(ctx); rbErr != nil {
+				return nil, rbErr
+			}
+
+			var pgErr *pgconn.PgError
+			if !errors.As(err, &pgErr) {
+				return nil, err
+			}
+
+			result.Status = ImportStatusRejected
+			result.Error = importRowError(row.Line, pgErr)
+			results = append(results, result)
+			continue
+		}
+
+		if err = savepoint.Commit(ctx); err != nil {
+			return nil, err
+		}
+
+		result.Status = ImportStatusUpdated
+		if created {
+			result.Status = ImportStatusCreated
+		}
+		results = append(results, result)
+	}
+
+	if dryRun {
+		return results, nil
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+func (r *pgxRepository) PartialUpdate(ctx context.Context, storeID, productID int64, req UpdateStockItemRequest) error {
+	updateBuilder := sq.Update("stock_items").
+		Where(sq.Eq{"store_id": storeID, "product_id": productID}).
+		PlaceholderFormat(sq.Dollar)
+	if req.Price != nil {
+		updateBuilder = updateBuilder.Set("price", *req.Price)
+	}
+	if req.Quantity != nil {
+		updateBuilder = updateBuilder.Set("quantity", *req.Quantity)
+	}
+	if req.Sector != nil {
+		updateBuilder = updateBuilder.Set("sector", *req.Sector)
+	}
+
+	sql, args, err := updateBuilder.ToSql()
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	oldPrice, err := lockCurrentPrice(ctx, tx, storeID, productID)
+	if err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(ctx, sql, args...); err != nil {
+		return err
+	}
+
+	if req.Price != nil && *req.Price != oldPrice {
+		if err = recordPriceChange(ctx, tx, storeID, productID, *req.Price); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (r *pgxRepository) Delete(ctx context.Context, storeID, productID int64) error {
+	query := `DELETE FROM stock_items WHERE store_id = $1 AND product_id = $2`
+
+	tag, err := r.db.Exec(ctx, query, storeID, productID)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrStockItemNotFount
+	}
+
+	return nil
+}
+
+// GetPriceHistory devolve as mudanças de preço de um produto entre from e to,
+// numa loja específica ou em todas quando storeID é nulo. A série de cada loja
+// começa com o último preço registrado antes de from, que é o que valia no
+// início do período mesmo sem mudanças dentro dele.
+func (r *pgxRepository) GetPriceHistory(ctx context.Context, productID int64, storeID *int64, from, to time.Time) ([]PricePoint, error) {
+	query := `WITH initial AS (
+				SELECT DISTINCT ON (store_id) id, store_id, price, changed_at
+				FROM stock_price_history
+				WHERE product_id = $1
+					AND ($2::bigint IS NULL OR store_id = $2)
+					AND changed_at < $3
+				ORDER BY store_id, changed_at DESC, id DESC
+			), series AS (
+				SELECT id, store_id, price, changed_at FROM initial
+				UNION ALL
+				SELECT id, store_id, price, changed_at
+				FROM stock_price_history
+				WHERE product_id = $1
+					AND ($2::bigint IS NULL OR store_id = $2)
+					AND changed_at BETWEEN $3 AND $4
+			)
+			SELECT
+				h.store_id,
+				s.name,
+				h.price,
+				h.changed_at
+			FROM series h
+			JOIN stores s ON h.store_id = s.id
+			WHERE s.status = 'approved'
+			ORDER BY h.changed_at, h.id`
+
+	rows, err := r.db.Query(ctx, query, productID, storeID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	points := make([]PricePoint, 0)
+
+	for rows.Next() {
+		var p PricePoint
+
+		err := rows.Scan(&p.StoreID, &p.StoreName, &p.Price, &p.ChangedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		points = append(points, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return points, nil
+}
+
+// lockCurrentPrice lê o preço atual do item travando a linha até o fim da transação.
+func lockCurrentPrice(ctx context.Context, tx pgx.Tx, storeID, productID int64) (float64, error) {
+	query := `SELECT price FROM stock_items WHERE store_id = $1 AND product_id = $2 FOR UPDATE`
+
+	var price float64
+	err := tx.QueryRow(ctx, query, storeID, productID).Scan(&price)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrStockItemNotFount
+		}
+		return 0, err
+	}
+
+	return price, nil
+}
+
+// upsertWithTx grava o item e registra o preço no histórico quando ele muda.
+func upsertWithTx(ctx context.Context, tx pgx.Tx, item StockItem) (StockItem, bool, error) {
+	oldPrice, err := lockCurrentPrice(ctx, tx, item.StoreID, item.ProductID)
+	if err != nil && !errors.Is(err, ErrStockItemNotFount) {
+		return StockItem{}, false, err
+	}
+
+	query := `INSERT INTO stock_items (store_id, product_id, price, quantity, sector)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (store_id, product_id) DO UPDATE
+			SET price = EXCLUDED.price, quantity = EXCLUDED.quantity, sector = EXCLUDED.sector
+			RETURNING id, (xmax = 0) AS inserted`
+
+	var created bool
+	err = tx.QueryRow(ctx, query,
+		item.StoreID,
+		item.ProductID,
+		item.Price,
+		item.Quantity,
+		item.Sector,
+	).Scan(&item.ID, &created)
+
+	if err != nil {
+		return StockItem{}, false, err
+	}
+
+	if created || oldPrice != item.Price {
+		if err = recordPriceChange(ctx, tx, item.StoreID, item.ProductID, item.Price); err != nil {
+			return StockItem{}, false, err
+		}
+	}
+
+	return item, created, nil
+}
+
+func recordPriceChange(ctx context.Context, tx pgx.Tx, storeID, productID int64, price float64) error {
+	query := `INSERT INTO stock_price_history (store_id, product_id, price) VALUES ($1, $2, $3)`
+
+	_, err := tx.Exec(ctx, query, storeID, productID, price)
+	return err
 }
@@ -1,21 +1,235 @@
 package stock
 
-import "context"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"localiza-compra/backend/internal/api/pagination"
+	"localiza-compra/backend/internal/api/product"
+	"math"
+	"sort"
+	"time"
+)
+
+const defaultSector = "Indefinido"
 
 type stockItemService struct {
-	repo Repository
+	repo        Repository
+	productRepo product.Repository
 }
 
-func NewService(r Repository) Service {
+func NewService(r Repository, pr product.Repository) Service {
 	return &stockItemService{
-		repo: r,
+		repo:        r,
+		productRepo: pr,
 	}
 }
 
 func (s *stockItemService) Create(ctx context.Context, item StockItem) (StockItem, error) {
+	if err := validateStockItem(item); err != nil {
+		return StockItem{}, err
+	}
+	if item.Sector == "" {
+		item.Sector = defaultSector
+	}
 	return s.repo.Create(ctx, item)
 }
 
-func (s *stockItemService) GetAllByStoreId(ctx context.Context, storeID int64) ([]ProductStockDetail, error) {
-	return s.repo.GetAllByStoreId(ctx, storeID)
+func (s *stockItemService) GetAllByStoreId(ctx context.Context, storeID int64, params pagination.Params) (pagination.Page[ProductStockDetail], error) {
+	items, total, err := s.repo.GetAllByStoreId(ctx, storeID, params)
+	if err != nil {
+		return pagination.Page[ProductStockDetail]{}, err
+	}
+	return pagination.NewPage(items, total, params), nil
+}
+
+func (s *stockItemService) Upsert(ctx context.Context, item StockItem) (StockItem, bool, error) {
+	if err := validateStockItem(item); err != nil {
+		return StockItem{}, false, err
+	}
+	if item.Sector == "" {
+		item.Sector = defaultSector
+	}
+	return s.repo.Upsert(ctx, item)
+}
+
+func (s *stockItemService) PartialUpdate(ctx context.Context, storeID, productID int64, req UpdateStockItemRequest) error {
+	if req.Price == nil && req.Quantity == nil && req.Sector == nil {
+		return fmt.Errorf("%w: nenhum campo para atualizar", ErrInvalidStockItem)
+	}
+	if req.Price != nil && !isFinite(*req.Price) {
+		return fmt.Errorf("%w: preço inválido", ErrInvalidStockItem)
+	}
+	if req.Price != nil && *req.Price < 0 {
+		return fmt.Errorf("%w: o preço não pode ser negativo", ErrInvalidStockItem)
+	}
+	if req.Quantity != nil && *req.Quantity < 0 {
+		return fmt.Errorf("%w: a quantidade não pode ser negativa", ErrInvalidStockItem)
+	}
+	if req.Sector != nil && *req.Sector == "" {
+		return fmt.Errorf("%w: o setor não pode ser vazio", ErrInvalidStockItem)
+	}
+	return s.repo.PartialUpdate(ctx, storeID, productID, req)
+}
+
+func (s *stockItemService) Delete(ctx context.Context, storeID, productID int64) error {
+	return s.repo.Delete(ctx, storeID, productID)
+}
+
+// GetPriceHistory monta a série de preços do período. Cada loja entra com o
+// preço que valia em from (quando já tinha um) e as mudanças seguintes; Min e
+// Max saem dessa série. Avg é a média simples dos pontos da série, sem pesar
+// quanto tempo cada preço durou, e sem storeID mistura os pontos de todas as
+// lojas.
+func (s *stockItemService) GetPriceHistory(ctx context.Context, productID int64, storeID *int64, from, to time.Time) (PriceHistory, error) {
+	if to.Before(from) {
+		return PriceHistory{}, fmt.Errorf("%w: a data final é anterior à inicial", ErrInvalidPeriod)
+	}
+
+	points, err := s.repo.GetPriceHistory(ctx, productID, storeID, from, to)
+	if err != nil {
+		return PriceHistory{}, err
+	}
+
+	history := PriceHistory{
+		ProductID: productID,
+		StoreID:   storeID,
+		From:      from,
+		To:        to,
+		Points:    points,
+	}
+
+	if len(points) == 0 {
+		return history, nil
+	}
+
+	history.Min, history.Max = points[0].Price, points[0].Price
+	var sum float64
+	for _, p := range points {
+		history.Min = math.Min(history.Min, p.Price)
+		history.Max = math.Max(history.Max, p.Price)
+		sum += p.Price
+	}
+	history.Avg = math.Round(sum/float64(len(points))*100) / 100
+
+	return history, nil
+}
+
+// Import valida as linhas e manda as válidas para o repositório numa única
+// transação. O relatório traz o resultado de todas as linhas, na ordem do arquivo.
+func (s *stockItemService) Import(ctx context.Context, storeID int64, rows []ImportRow, dryRun bool) (ImportReport, error) {
+	if len(rows) == 0 {
+		return ImportReport{}, fmt.Errorf("%w: nenhuma linha para importar", ErrInvalidImportFile)
+	}
+
+	report := ImportReport{DryRun: dryRun, Rows: make([]ImportRowResult, 0, len(rows))}
+
+	valid := make([]ImportRow, 0, len(rows))
+	for _, row := range rows {
+		if row.Sector == "" {
+			row.Sector = defaultSector
+		}
+
+		reason := row.Error
+		if reason == "" && row.ProductID == 0 && row.Barcode != "" {
+			var err error
+			row.ProductID, reason, err = s.resolveImportBarcode(ctx, row.Barcode)
+			if err != nil {
+				return ImportReport{}, err
+			}
+		}
+		if reason == "" {
+			reason = validateImportRow(row)
+		}
+		if reason != "" {
+			report.Rows = append(report.Rows, ImportRowResult{
+				Line:      row.Line,
+				ProductID: row.ProductID,
+				Barcode:   row.Barcode,
+				Status:    ImportStatusRejected,
+				Error:     reason,
+			})
+			continue
+		}
+
+		valid = append(valid, row)
+	}
+
+	if len(valid) > 0 {
+		results, err := s.repo.Import(ctx, storeID, valid, dryRun)
+		if err != nil {
+			return ImportReport{}, err
+		}
+		report.Rows = append(report.Rows, results...)
+	}
+
+	sort.SliceStable(report.Rows, func(i, j int) bool { return report.Rows[i].Line < report.Rows[j].Line })
+
+	for _, r := range report.Rows {
+		switch r.Status {
+		case ImportStatusCreated:
+			report.Created++
+		case ImportStatusUpdated:
+			report.Updated++
+		case ImportStatusRejected:
+			report.Rejected++
+		}
+	}
+
+	return report, nil
+}
+
+func (s *stockItemService) ResolveProductID(ctx context.Context, barcode string) (int64, error) {
+	return product.ResolveID(ctx, s.productRepo, 0, barcode)
+}
+
+// resolveImportBarcode troca o código de barras da linha pelo ID do produto.
+// Um motivo de rejeição é devolvido quando o código não serve.
+func (s *stockItemService) resolveImportBarcode(ctx context.Context, barcode string) (int64, string, error) {
+	productID, err := s.ResolveProductID(ctx, barcode)
+	switch {
+	case err == nil:
+		return productID, "", nil
+	case errors.Is(err, product.ErrInvalidBarcode):
+		return 0, "código de barras inválido", nil
+	case errors.Is(err, product.ErrProductNotFound):
+		return 0, "nenhum produto com este código de barras", nil
+	default:
+		return 0, "", err
+	}
+}
+
+func validateImportRow(row ImportRow) string {
+	if row.ProductID == 0 && row.Barcode == "" {
+		return "informe o product_id ou o barcode"
+	}
+	if !isFinite(row.Price) {
+		return "preço inválido"
+	}
+	if row.Price < 0 {
+		return "o preço não pode ser negativo"
+	}
+	if row.Quantity < 0 {
+		return "a quantidade não pode ser negativa"
+	}
+	return ""
+}
+
+func validateStockItem(item StockItem) error {
+	if !isFinite(item.Price) {
+		return fmt.Errorf("%w: preço inválido", ErrInvalidStockItem)
+	}
+	if item.Price < 0 {
+		return fmt.Errorf("%w: o preço não pode ser negativo", ErrInvalidStockItem)
+	}
+	if item.Quantity < 0 {
+		return fmt.Errorf("%w: a quantidade não pode ser negativa", ErrInvalidStockItem)
+	}
+	return nil
+}
+
+// isFinite recusa NaN e infinito, que o numeric do Postgres aceitaria mas o
+// JSON das respostas não consegue representar.
+func isFinite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
 }
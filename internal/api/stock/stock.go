@@ -3,9 +3,14 @@ package stock
 import (
 	"context"
 	"errors"
+	"localiza-compra/backend/internal/api/pagination"
+	"time"
 )
 
 var ErrStockItemNotFount = errors.New("item de estoque não encontrado")
+var ErrStockItemAlreadyExists = errors.New("o produto já está no estoque desta loja")
+var ErrInvalidStockItem = errors.New("item de estoque inválido")
+var ErrInvalidPeriod = errors.New("período inválido")
 
 type StockItem struct {
 	ID        int64   `json:"id"`
@@ -22,6 +27,13 @@ type CreateStockItemRequest struct {
 	Sector   string  `json:"sector"`
 }
 
+// UpdateStockItemRequest é o DTO para atualizações parciais (PATCH)
+type UpdateStockItemRequest struct {
+	Price    *float64 `json:"price,omitempty"`
+	Quantity *int     `json:"quantity,omitempty"`
+	Sector   *string  `json:"sector,omitempty"`
+}
+
 type ProductStockDetail struct {
 	ProductID   int64   `json:"product_id"`
 	Name        string  `json:"name"`
@@ -31,12 +43,44 @@ type ProductStockDetail struct {
 	Sector      string  `json:"sector"`
 }
 
+type PricePoint struct {
+	StoreID   int64     `json:"store_id"`
+	StoreName string    `json:"store_name"`
+	Price     float64   `json:"price"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// PriceHistory é a série de preços de um produto. O primeiro ponto de cada
+// loja pode ser anterior a From: é o preço que já valia no início do período.
+type PriceHistory struct {
+	ProductID int64        `json:"product_id"`
+	StoreID   *int64       `json:"store_id,omitempty"`
+	From      time.Time    `json:"from"`
+	To        time.Time    `json:"to"`
+	Points    []PricePoint `json:"points"`
+	Min       float64      `json:"min"`
+	Max       float64      `json:"max"`
+	// Média simples dos pontos, não ponderada pelo tempo
+	Avg float64 `json:"avg"`
+}
+
 type Repository interface {
 	Create(ctx context.Context, item StockItem) (StockItem, error)
-	GetAllByStoreId(ctx context.Context, storeID int64) ([]ProductStockDetail, error)
+	GetAllByStoreId(ctx context.Context, storeID int64, params pagination.Params) ([]ProductStockDetail, int, error)
+	Upsert(ctx context.Context, item StockItem) (StockItem, bool, error)
+	PartialUpdate(ctx context.Context, storeID, productID int64, req UpdateStockItemRequest) error
+	Delete(ctx context.Context, storeID, productID int64) error
+	GetPriceHistory(ctx context.Context, productID int64, storeID *int64, from, to time.Time) ([]PricePoint, error)
+	Import(ctx context.Context, storeID int64, rows []ImportRow, dryRun bool) ([]ImportRowResult, error)
 }
 
 type Service interface {
 	Create(ctx context.Context, item StockItem) (StockItem, error)
-	GetAllByStoreId(ctx context.Context, storeID int64) ([]ProductStockDetail, error)
+	GetAllByStoreId(ctx context.Context, storeID int64, params pagination.Params) (pagination.Page[ProductStockDetail], error)
+	Upsert(ctx context.Context, item StockItem) (StockItem, bool, error)
+	PartialUpdate(ctx context.Context, storeID, productID int64, req UpdateStockItemRequest) error
+	Delete(ctx context.Context, storeID, productID int64) error
+	GetPriceHistory(ctx context.Context, productID int64, storeID *int64, from, to time.Time) (PriceHistory, error)
+	Import(ctx context.Context, storeID int64, rows []ImportRow, dryRun bool) (ImportReport, error)
+	ResolveProductID(ctx context.Context, barcode string) (int64, error)
 }
@@ -0,0 +1,382 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+)
+
+// StoreDetails é a loja com o horário de funcionamento, para GET /stores/{id}.
+type StoreDetails struct {
+	Store
+	OpeningHours []OpeningHours `json:"opening_hours"`
+	// Exceções de ontem em diante
+	Exceptions []HoursException `json:"hour_exceptions"`
+	OpenNow    bool             `json:"open_now"`
+}
+
+// UpdateStoreRequest é o corpo de PATCH /stores/{id}. Os campos ausentes não
+// mudam; opening_hours e hour_exceptions, quando enviados, substituem a lista
+// inteira. O CNPJ não pode ser alterado.
+type UpdateStoreRequest struct {
+	Name         *string           `json:"name"`
+	Address      *string           `json:"address"`
+	CEP          *string           `json:"cep"`
+	City         *string           `json:"city"`
+	State        *string           `json:"state"`
+	Phone        *string           `json:"phone"`
+	Latitude     *float64          `json:"latitude"`
+	Longitude    *float64          `json:"longitude"`
+	Timezone     *string           `json:"timezone"`
+	OpeningHours *[]OpeningHours   `json:"opening_hours"`
+	Exceptions   *[]HoursException `json:"hour_exceptions"`
+}
+
+// Códigos de ValidationError usados na edição da loja
+const (
+	CodeInvalidFormat = "invalid_format"
+	CodeOutOfRange    = "out_of_range"
+)
+
+var brazilianStates = []string{
+	"AC", "AL", "AP", "AM", "BA", "CE", "DF", "ES", "GO", "MA", "MT", "MS", "MG", "PA",
+	"PB", "PR", "PE", "PI", "RJ", "RN", "RS", "RO", "RR", "SC", "SP", "SE", "TO",
+}
+
+func digitsOnly(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+func invalidField(field, code, message string) error {
+	return &ValidationError{Field: field, Code: code, Message: message}
+}
+
+// normalize valida o pedido e deixa CEP, UF e telefone no formato gravado.
+func (req *UpdateStoreRequest) normalize() error {
+	if req.Name != nil {
+		*req.Name = strings.TrimSpace(*req.Name)
+		if err := requireField("name", *req.Name, "o nome da loja não pode ser vazio"); err != nil {
+			return err
+		}
+	}
+	if req.Address != nil {
+		*req.Address = strings.TrimSpace(*req.Address)
+		if err := requireField("address", *req.Address, "o endereço da loja não pode ser vazio"); err != nil {
+			return err
+		}
+	}
+	if req.CEP != nil {
+		*req.CEP = digitsOnly(*req.CEP)
+		if len(*req.CEP) != 8 {
+			return invalidField("cep", CodeInvalidFormat, "o CEP precisa ter 8 dígitos")
+		}
+	}
+	if req.City != nil {
+		*req.City = strings.TrimSpace(*req.City)
+		if err := requireField("city", *req.City, "a cidade não pode ser vazia"); err != nil {
+			return err
+		}
+	}
+	if req.State != nil {
+		*req.State = strings.ToUpper(strings.TrimSpace(*req.State))
+		if !slices.Contains(brazilianStates, *req.State) {
+			return invalidField("state", CodeInvalidFormat, "UF inválida")
+		}
+	}
+	if req.Phone != nil {
+		*req.Phone = digitsOnly(*req.Phone)
+		// DDD + 8 dígitos do fixo ou 9 do celular
+		if len(*req.Phone) != 10 && len(*req.Phone) != 11 {
+			return invalidField("phone", CodeInvalidFormat, "o telefone precisa ter DDD e 8 ou 9 dígitos")
+		}
+	}
+
+	if (req.Latitude == nil) != (req.Longitude == nil) {
+		field := "latitude"
+		if req.Longitude == nil {
+			field = "longitude"
+		}
+		return invalidField(field, CodeRequired, "informe latitude e longitude juntas")
+	}
+	if req.Latitude != nil {
+		if math.IsNaN(*req.Latitude) || *req.Latitude < -90 || *req.Latitude > 90 {
+			return invalidField("latitude", CodeOutOfRange, "a latitude precisa estar entre -90 e 90")
+		}
+		if math.IsNaN(*req.Longitude) || *req.Longitude < -180 || *req.Longitude > 180 {
+			return invalidField("longitude", CodeOutOfRange, "a longitude precisa estar entre -180 e 180")
+		}
+	}
+
+	if req.Timezone != nil {
+		*req.Timezone = strings.TrimSpace(*req.Timezone)
+		if _, err := time.LoadLocation(*req.Timezone); err != nil || *req.Timezone == "" || *req.Timezone == "Local" {
+			return invalidField("timezone", CodeInvalidFormat, "fuso horário desconhecido (use o nome IANA, ex.: America/Sao_Paulo)")
+		}
+	}
+
+	if req.OpeningHours != nil {
+		for i, h := range *req.OpeningHours {
+			field := fmt.Sprintf("opening_hours[%d]", i)
+			if h.Weekday < 0 || h.Weekday > 6 {
+				return invalidField(field+".weekday", CodeOutOfRange, "o dia da semana vai de 0 (domingo) a 6 (sábado)")
+			}
+			if err := validateInterval(field, h.Opens, h.Closes); err != nil {
+				return err
+			}
+		}
+	}
+
+	if req.Exceptions != nil {
+		seen := make(map[string]bool, len(*req.Exceptions))
+		for i, ex := range *req.Exceptions {
+			field := fmt.Sprintf("hour_exceptions[%d]", i)
+			if _, err := time.Parse(dateLayout, ex.Date); err != nil {
+				return invalidField(field+".date", CodeInvalidFormat, "use a data no formato AAAA-MM-DD")
+			}
+			if seen[ex.Date] {
+				return invalidField(field+".date", CodeAlreadyInUse, "já existe uma exceção para esta data")
+			}
+			seen[ex.Date] = true
+
+			if ex.Closed {
+				(*req.Exceptions)[i].Opens, (*req.Exceptions)[i].Closes = nil, nil
+				continue
+			}
+			if ex.Opens == nil || ex.Closes == nil {
+				return invalidField(field, CodeRequired, "informe o horário ou marque a data como fechada")
+			}
+			if err := validateInterval(field, *ex.Opens, *ex.Closes); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func validateInterval(field, opens, closes string) error {
+	o, err := parseClock(opens)
+	if err != nil {
+		return invalidField(field+".opens", CodeInvalidFormat, "use o horário no formato HH:MM")
+	}
+	c, err := parseClock(closes)
+	if err != nil {
+		return invalidField(field+".closes", CodeInvalidFormat, "use o horário no formato HH:MM")
+	}
+	if o == c {
+		return invalidField(field+".closes", CodeOutOfRange, "a abertura e o fechamento não podem ser iguais")
+	}
+	return nil
+}
+
+func (r *pgxRepository) GetOpeningHours(ctx context.Context, storeID int64) ([]OpeningHours, error) {
+	query := `SELECT weekday, to_char(opens_at, 'HH24:MI'), to_char(closes_at, 'HH24:MI')
+			FROM store_opening_hours
+			WHERE store_id = $1
+			ORDER BY weekday, opens_at`
+
+	rows, err := r.db.Query(ctx, query, storeID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	hours := make([]OpeningHours, 0)
+
+	for rows.Next() {
+		var h OpeningHours
+		if err := rows.Scan(&h.Weekday, &h.Opens, &h.Closes); err != nil {
+			return nil, err
+		}
+		hours = append(hours, h)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return hours, nil
+}
+
+// GetHourExceptions devolve as exceções a partir da data from (AAAA-MM-DD).
+func (r *pgxRepository) GetHourExceptions(ctx context.Context, storeID int64, from string) ([]HoursException, error) {
+	query := `SELECT to_char(date, 'YYYY-MM-DD'), closed, to_char(opens_at, 'HH24:MI'), to_char(closes_at, 'HH24:MI'), note
+			FROM store_hour_exceptions
+			WHERE store_id = $1 AND date >= $2::date
+			ORDER BY date`
+
+	rows, err := r.db.Query(ctx, query, storeID, from)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	exceptions := make([]HoursException, 0)
+
+	for rows.Next() {
+		var ex HoursException
+		if err := rows.Scan(&ex.Date, &ex.Closed, &ex.Opens, &ex.Closes, &ex.Note); err != nil {
+			return nil, err
+		}
+		exceptions = append(exceptions, ex)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return exceptions, nil
+}
+
+// Update grava os dados da loja e troca os horários numa única transação.
+func (r *pgxRepository) Update(ctx context.Context, storeID int64, req UpdateStoreRequest) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	var id int64
+	err = tx.QueryRow(ctx, `SELECT id FROM stores WHERE id = $1 FOR UPDATE`, storeID).Scan(&id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrStoreNotFound
+		}
+		return err
+	}
+
+	updateBuilder := sq.Update("stores").
+		Where(sq.Eq{"id": storeID}).
+		PlaceholderFormat(sq.Dollar)
+	changed := false
+	set := func(column string, value any) {
+		updateBuilder = updateBuilder.Set(column, value)
+		changed = true
+	}
+	if req.Name != nil {
+		set("name", *req.Name)
+	}
+	if req.Address != nil {
+		set("address", *req.Address)
+	}
+	if req.CEP != nil {
+		set("cep", *req.CEP)
+	}
+	if req.City != nil {
+		set("city", *req.City)
+	}
+	if req.State != nil {
+		set("state", *req.State)
+	}
+	if req.Phone != nil {
+		set("phone", *req.Phone)
+	}
+	if req.Latitude != nil && req.Longitude != nil {
+		set("latitude", *req.Latitude)
+		set("longitude", *req.Longitude)
+	}
+	if req.Timezone != nil {
+		set("timezone", *req.Timezone)
+	}
+
+	if changed {
+		sql, args, err := updateBuilder.ToSql()
+		if err != nil {
+			return err
+		}
+		if _, err = tx.Exec(ctx, sql, args...); err != nil {
+			return err
+		}
+	}
+
+	if req.OpeningHours != nil {
+		if _, err = tx.Exec(ctx, `DELETE FROM store_opening_hours WHERE store_id = $1`, storeID); err != nil {
+			return err
+		}
+		for _, h := range *req.OpeningHours {
+			_, err = tx.Exec(ctx,
+				`INSERT INTO store_opening_hours (store_id, weekday, opens_at, closes_at) VALUES ($1, $2, $3::time, $4::time)`,
+				storeID, h.Weekday, h.Opens, h.Closes)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if req.Exceptions != nil {
+		if _, err = tx.Exec(ctx, `DELETE FROM store_hour_exceptions WHERE store_id = $1`, storeID); err != nil {
+			return err
+		}
+		for _, ex := range *req.Exceptions {
+			_, err = tx.Exec(ctx,
+				`INSERT INTO store_hour_exceptions (store_id, date, closed, opens_at, closes_at, note)
+				VALUES ($1, $2::date, $3, $4::time, $5::time, $6)`,
+				storeID, ex.Date, ex.Closed, ex.Opens, ex.Closes, strings.TrimSpace(ex.Note))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetDetails monta a loja com os horários e calcula se ela está aberta agora,
+// no fuso horário da loja.
+func (s *storeService) GetDetails(ctx context.Context, id int64) (StoreDetails, error) {
+	store, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return StoreDetails{}, err
+	}
+
+	loc, err := time.LoadLocation(store.Timezone)
+	if err != nil {
+		return StoreDetails{}, fmt.Errorf("fuso horário da loja %d: %w", store.ID, err)
+	}
+
+	hours, err := s.repo.GetOpeningHours(ctx, store.ID)
+	if err != nil {
+		return StoreDetails{}, err
+	}
+
+	// A exceção de ontem ainda vale para um horário que passou da meia-noite
+	now := time.Now().In(loc)
+	exceptions, err := s.repo.GetHourExceptions(ctx, store.ID, now.AddDate(0, 0, -1).Format(dateLayout))
+	if err != nil {
+		return StoreDetails{}, err
+	}
+
+	return StoreDetails{
+		Store:        store,
+		OpeningHours: hours,
+		Exceptions:   exceptions,
+		OpenNow:      isOpenAt(now, loc, hours, exceptions),
+	}, nil
+}
+
+func (s *storeService) Update(ctx context.Context, storeID int64, req UpdateStoreRequest) (StoreDetails, error) {
+	if err := req.normalize(); err != nil {
+		return StoreDetails{}, err
+	}
+
+	if err := s.repo.Update(ctx, storeID, req); err != nil {
+		return StoreDetails{}, err
+	}
+
+	return s.GetDetails(ctx, storeID)
+}
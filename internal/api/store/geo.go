@@ -0,0 +1,214 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"localiza-compra/backend/internal/api/pagination"
+	"localiza-compra/backend/internal/geocoder"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+const (
+	DefaultRadiusKm = 5.0
+	MaxRadiusKm     = 50.0
+
+	// Quilômetros por grau de latitude, para a caixa em volta do ponto
+	kmPerDegree = 111.32
+)
+
+// Código de ValidationError para CEP fora da tabela do geocoder
+const CodeNotFound = "not_found"
+
+// NearbyQuery é o ponto de referência da busca por proximidade: latitude e
+// longitude ou, no lugar delas, um CEP resolvido pelo geocoder.
+type NearbyQuery struct {
+	Latitude  *float64
+	Longitude *float64
+	CEP       string
+	RadiusKm  float64
+}
+
+// NearbyStore é a loja com a distância em linha reta até o ponto buscado.
+type NearbyStore struct {
+	Store
+	DistanceKm float64 `json:"distance_km"`
+}
+
+// ParseNearbyQuery lê ?lat=&lng= ou ?cep= e ?radius_km=. O booleano é falso
+// quando a requisição não traz nenhuma localização.
+func ParseNearbyQuery(r *http.Request) (NearbyQuery, bool, error) {
+	query := r.URL.Query()
+	q := NearbyQuery{CEP: query.Get("cep"), RadiusKm: DefaultRadiusKm}
+
+	parseCoord := func(name string, limit float64) (*float64, error) {
+		v := query.Get(name)
+		if v == "" {
+			return nil, nil
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || math.IsNaN(f) || f < -limit || f > limit {
+			return nil, &ValidationError{Field: name, Code: CodeOutOfRange, Message: fmt.Sprintf("%s precisa estar entre -%g e %g", name, limit, limit)}
+		}
+		return &f, nil
+	}
+
+	var err error
+	if q.Latitude, err = parseCoord("lat", 90); err != nil {
+		return NearbyQuery{}, false, err
+	}
+	if q.Longitude, err = parseCoord("lng", 180); err != nil {
+		return NearbyQuery{}, false, err
+	}
+
+	if v := query.Get("radius_km"); v != "" {
+		radius, err := strconv.ParseFloat(v, 64)
+		if err != nil || !(radius > 0 && radius <= MaxRadiusKm) {
+			return NearbyQuery{}, false, &ValidationError{Field: "radius_km", Code: CodeOutOfRange, Message: fmt.Sprintf("radius_km precisa ser maior que 0 e no máximo %g", MaxRadiusKm)}
+		}
+		q.RadiusKm = radius
+	}
+
+	if q.Latitude == nil && q.Longitude == nil && q.CEP == "" {
+		return NearbyQuery{}, false, nil
+	}
+	if (q.Latitude == nil) != (q.Longitude == nil) {
+		return NearbyQuery{}, false, &ValidationError{Field: "lat", Code: CodeRequired, Message: "informe lat e lng juntas"}
+	}
+
+	return q, true, nil
+}
+
+// resolve devolve o ponto da busca, consultando o geocoder quando veio um CEP.
+func (s *storeService) resolve(ctx context.Context, q NearbyQuery) (geocoder.Point, error) {
+	if q.Latitude != nil && q.Longitude != nil {
+		return geocoder.Point{Latitude: *q.Latitude, Longitude: *q.Longitude}, nil
+	}
+
+	p, err := s.geocoder.LookupCEP(ctx, q.CEP)
+	switch {
+	case errors.Is(err, geocoder.ErrInvalidCEP):
+		return geocoder.Point{}, &ValidationError{Field: "cep", Code: CodeInvalidFormat, Message: err.Error()}
+	case errors.Is(err, geocoder.ErrNotFound):
+		return geocoder.Point{}, &ValidationError{Field: "cep", Code: CodeNotFound, Message: err.Error()}
+	}
+	return p, err
+}
+
+// Nearby lista as lojas aprovadas dentro do raio, da mais próxima para a mais distante.
+func (s *storeService) Nearby(ctx context.Context, q NearbyQuery, params pagination.Params) (pagination.Page[NearbyStore], error) {
+	p, err := s.resolve(ctx, q)
+	if err != nil {
+		return pagination.Page[NearbyStore]{}, err
+	}
+
+	stores, total, err := s.repo.GetNearby(ctx, p, q.RadiusKm, params)
+	if err != nil {
+		return pagination.Page[NearbyStore]{}, err
+	}
+	return pagination.NewPage(stores, total, params), nil
+}
+
+// NearbyIDs devolve só os IDs das lojas dentro do raio, para limitar as
+// lojas candidatas do otimizador de listas.
+func (s *storeService) NearbyIDs(ctx context.Context, q NearbyQuery) ([]int64, error) {
+	p, err := s.resolve(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.GetNearbyIDs(ctx, p, q.RadiusKm)
+}
+
+// nearbyCTE monta a consulta "nearby" com a distância pela fórmula de
+// haversine. A caixa em volta do ponto descarta pelo índice as lojas que com
+// certeza estão fora do raio antes do cálculo. Usa os parâmetros $1 a $5.
+func nearbyCTE(p geocoder.Point, radiusKm float64) (string, []any) {
+	latDelta := radiusKm / kmPerDegree
+	lngDelta := 180.0
+	if c := math.Cos(p.Latitude * math.Pi / 180); c > 0.01 {
+		lngDelta = radiusKm / (kmPerDegree * c)
+	}
+
+	query := `WITH nearby AS (
+			SELECT ` + storeColumns + `,
+				2 * 6371 * asin(LEAST(1, sqrt(
+					power(sin(radians(latitude - $1) / 2), 2)
+					+ cos(radians($1)) * cos(radians(latitude)) * power(sin(radians(longitude - $2) / 2), 2)
+				))) AS distance_km
+			FROM stores
+			WHERE status = 'approved'
+				AND latitude BETWEEN $1 - $4 AND $1 + $4
+				AND longitude BETWEEN $2 - $5 AND $2 + $5
+		)`
+
+	return query, []any{p.Latitude, p.Longitude, radiusKm, latDelta, lngDelta}
+}
+
+func (r *pgxRepository) GetNearby(ctx context.Context, p geocoder.Point, radiusKm float64, params pagination.Params) ([]NearbyStore, int, error) {
+	cte, args := nearbyCTE(p, radiusKm)
+
+	var total int
+	err := r.db.QueryRow(ctx, cte+` SELECT COUNT(*) FROM nearby WHERE distance_km <= $3`, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := cte + ` SELECT ` + storeColumns + `, distance_km
+		FROM nearby
+		WHERE distance_km <= $3
+		ORDER BY distance_km, id
+		LIMIT $6 OFFSET $7`
+
+	rows, err := r.db.Query(ctx, query, append(args, params.Limit, params.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer rows.Close()
+
+	stores := make([]NearbyStore, 0)
+
+	for rows.Next() {
+		var s NearbyStore
+		if err := rows.Scan(append(storeFields(&s.Store), &s.DistanceKm)...); err != nil {
+			return nil, 0, err
+		}
+		s.DistanceKm = math.Round(s.DistanceKm*100) / 100
+		stores = append(stores, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return stores, total, nil
+}
+
+func (r *pgxRepository) GetNearbyIDs(ctx context.Context, p geocoder.Point, radiusKm float64) ([]int64, error) {
+	cte, args := nearbyCTE(p, radiusKm)
+
+	rows, err := r.db.Query(ctx, cte+` SELECT id FROM nearby WHERE distance_km <= $3 ORDER BY distance_km, id`, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	ids := make([]int64, 0)
+
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
@@ -2,8 +2,16 @@ package store
 
 import (
 	"encoding/json"
+	"errors"
+	"localiza-compra/backend/internal/api/middleware"
+	"localiza-compra/backend/internal/api/pagination"
+	"localiza-compra/backend/internal/api/role"
+	"localiza-compra/backend/internal/api/user"
 	"log"
 	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
 )
 
 type storeHandler struct {
@@ -27,8 +35,7 @@ func (h *storeHandler) CreateStoreWithAdmin(w http.ResponseWriter, r *http.Reque
 
 	createdStore, err := h.service.CreateStoreWithAdmin(r.Context(), req)
 	if err != nil {
-		log.Printf("Erro ao criar loja: %v", err)
-		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+		writeCreateError(w, err)
 		return
 	}
 
@@ -37,15 +44,463 @@ func (h *storeHandler) CreateStoreWithAdmin(w http.ResponseWriter, r *http.Reque
 	json.NewEncoder(w).Encode(createdStore)
 }
 
+// writeCreateError devolve os erros de validação em JSON, com o campo e o
+// código, para o formulário de cadastro mostrar a mensagem no lugar certo.
+func writeCreateError(w http.ResponseWriter, err error) {
+	var validationErr *ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		writeValidationError(w, http.StatusBadRequest, validationErr)
+	case errors.Is(err, ErrCNPJAlreadyInUse):
+		writeValidationError(w, http.StatusConflict, &ValidationError{Field: "cnpj", Code: CodeAlreadyInUse, Message: err.Error()})
+	default:
+		log.Printf("Erro ao criar loja: %v", err)
+		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+	}
+}
+
+func writeValidationError(w http.ResponseWriter, status int, err *ValidationError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(err)
+}
+
+// listOptions define a ordenação e os filtros aceitos em GET /stores
+var listOptions = pagination.Options{
+	Sorts: map[string]string{
+		"name":       "name",
+		"created_at": "created_at",
+	},
+	DefaultSort: "name",
+	Tiebreaker:  "id",
+	Filters: map[string]pagination.Filter{
+		"name": {Column: "name", Kind: pagination.FilterContains},
+		"cnpj": {Column: "cnpj", Kind: pagination.FilterText},
+	},
+}
+
 func (h *storeHandler) GetAll(w http.ResponseWriter, r *http.Request) {
-	stores, err := h.service.GetAll(r.Context())
+	params, err := pagination.Parse(r, listOptions)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stores, err := h.service.GetAll(r.Context(), params)
 	if err != nil {
 		log.Printf("Erro ao buscar produtos: %v", err)
 		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
 		return
 	}
 
+	stores.SetLinks(w, r)
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(stores)
 }
+
+// staffListOptions define a ordenação e os filtros de GET /stores/{storeID}/staff
+var staffListOptions = pagination.Options{
+	Sorts: map[string]string{
+		"name":  "name",
+		"email": "email",
+		"role":  "role",
+	},
+	DefaultSort: "name",
+	Tiebreaker:  "id",
+	Filters: map[string]pagination.Filter{
+		"role": {Column: "role", Kind: pagination.FilterText},
+	},
+}
+
+func (h *storeHandler) Invite(w http.ResponseWriter, r *http.Request) {
+	storeID, err := strconv.ParseInt(chi.URLParam(r, "storeID"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID da loja inválido", http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "ID do usuário inválido no contexto", http.StatusInternalServerError)
+		return
+	}
+
+	var req InviteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Corpo da requisição inválido", http.StatusBadRequest)
+		return
+	}
+
+	invitation, err := h.service.Invite(r.Context(), storeID, userID, req)
+	if err != nil {
+		writeStaffError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(invitation)
+}
+
+func (h *storeHandler) ListInvitations(w http.ResponseWriter, r *http.Request) {
+	storeID, err := strconv.ParseInt(chi.URLParam(r, "storeID"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID da loja inválido", http.StatusBadRequest)
+		return
+	}
+
+	invitations, err := h.service.ListInvitations(r.Context(), storeID)
+	if err != nil {
+		writeStaffError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(invitations)
+}
+
+func (h *storeHandler) RevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	storeID, err := strconv.ParseInt(chi.URLParam(r, "storeID"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID da loja inválido", http.StatusBadRequest)
+		return
+	}
+
+	invitationID, err := strconv.ParseInt(chi.URLParam(r, "invitationID"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID do convite inválido", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.RevokeInvitation(r.Context(), storeID, invitationID); err != nil {
+		writeStaffError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AcceptInvitation é chamado pelo convidado, já logado com o e-mail do convite.
+func (h *storeHandler) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "ID do usuário inválido no contexto", http.StatusInternalServerError)
+		return
+	}
+
+	var req AcceptInvitationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Corpo da requisição inválido", http.StatusBadRequest)
+		return
+	}
+
+	invitation, err := h.service.AcceptInvitation(r.Context(), userID, req.Token)
+	if err != nil {
+		writeStaffError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(invitation)
+}
+
+func (h *storeHandler) ListStaff(w http.ResponseWriter, r *http.Request) {
+	storeID, err := strconv.ParseInt(chi.URLParam(r, "storeID"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID da loja inválido", http.StatusBadRequest)
+		return
+	}
+
+	params, err := pagination.Parse(r, staffListOptions)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	staff, err := h.service.ListStaff(r.Context(), storeID, params)
+	if err != nil {
+		writeStaffError(w, err)
+		return
+	}
+
+	staff.SetLinks(w, r)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(staff)
+}
+
+func (h *storeHandler) RemoveStaff(w http.ResponseWriter, r *http.Request) {
+	storeID, err := strconv.ParseInt(chi.URLParam(r, "storeID"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID da loja inválido", http.StatusBadRequest)
+		return
+	}
+
+	staffID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID do usuário inválido", http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "ID do usuário inválido no contexto", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.service.RemoveStaff(r.Context(), storeID, userID, staffID); err != nil {
+		writeStaffError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeStaffError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrStoreNotFound), errors.Is(err, ErrInvitationNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, user.ErrUserNotFound):
+		http.Error(w, "Usuário não encontrado", http.StatusNotFound)
+	case errors.Is(err, ErrInvalidEmail), errors.Is(err, ErrInvalidInvitationRole), errors.Is(err, ErrNotStaff):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrInvitationEmailMismatch):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, ErrAlreadyStaff), errors.Is(err, ErrLastStoreAdmin), errors.Is(err, user.ErrLastSuperAdmin):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Printf("Erro na equipe da loja: %v", err)
+		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+	}
+}
+
+// reviewListOptions define a ordenação e os filtros de GET /admin/stores
+var reviewListOptions = pagination.Options{
+	Sorts: map[string]string{
+		"name":       "name",
+		"created_at": "created_at",
+		"status":     "status",
+	},
+	DefaultSort: "created_at",
+	Tiebreaker:  "id",
+	Filters: map[string]pagination.Filter{
+		"name":   {Column: "name", Kind: pagination.FilterContains},
+		"cnpj":   {Column: "cnpj", Kind: pagination.FilterText},
+		"status": {Column: "status", Kind: pagination.FilterText},
+	},
+}
+
+// ListForReview lista as lojas em qualquer situação; ?status=pending traz a fila de aprovação.
+func (h *storeHandler) ListForReview(w http.ResponseWriter, r *http.Request) {
+	params, err := pagination.Parse(r, reviewListOptions)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stores, err := h.service.ListForReview(r.Context(), params)
+	if err != nil {
+		log.Printf("Erro ao buscar lojas: %v", err)
+		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+		return
+	}
+
+	stores.SetLinks(w, r)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(stores)
+}
+
+func (h *storeHandler) GetForReview(w http.ResponseWriter, r *http.Request) {
+	storeID, err := strconv.ParseInt(chi.URLParam(r, "storeID"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID da loja inválido", http.StatusBadRequest)
+		return
+	}
+
+	store, err := h.service.GetByID(r.Context(), storeID)
+	if err != nil {
+		writeReviewError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(store)
+}
+
+func (h *storeHandler) Approve(w http.ResponseWriter, r *http.Request) {
+	h.review(w, r, StatusApproved)
+}
+
+func (h *storeHandler) Reject(w http.ResponseWriter, r *http.Request) {
+	h.review(w, r, StatusRejected)
+}
+
+func (h *storeHandler) Suspend(w http.ResponseWriter, r *http.Request) {
+	h.review(w, r, StatusSuspended)
+}
+
+func (h *storeHandler) review(w http.ResponseWriter, r *http.Request, to Status) {
+	storeID, err := strconv.ParseInt(chi.URLParam(r, "storeID"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID da loja inválido", http.StatusBadRequest)
+		return
+	}
+
+	reviewerID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "ID do usuário inválido no contexto", http.StatusInternalServerError)
+		return
+	}
+
+	// O corpo é opcional na aprovação
+	var req ReviewStoreRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Corpo da requisição inválido", http.StatusBadRequest)
+			return
+		}
+	}
+
+	store, err := h.service.Review(r.Context(), storeID, reviewerID, to, req.Reason)
+	if err != nil {
+		writeReviewError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(store)
+}
+
+func writeReviewError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrStoreNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrReasonRequired):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrInvalidStatusTransition):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Printf("Erro ao revisar a loja: %v", err)
+		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+	}
+}
+
+// GetDetails mostra a loja com endereço, contato e horários. Lojas que ainda
+// não foram aprovadas só aparecem para a própria equipe e para super admins.
+func (h *storeHandler) GetDetails(w http.ResponseWriter, r *http.Request) {
+	storeID, err := strconv.ParseInt(chi.URLParam(r, "storeID"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID da loja inválido", http.StatusBadRequest)
+		return
+	}
+
+	details, err := h.service.GetDetails(r.Context(), storeID)
+	if err != nil {
+		writeReviewError(w, err)
+		return
+	}
+
+	if details.Status != StatusApproved && !canSeeUnapproved(r, storeID) {
+		http.Error(w, ErrStoreNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(details)
+}
+
+func canSeeUnapproved(r *http.Request, storeID int64) bool {
+	userRole, _ := r.Context().Value(middleware.UserRoleKey).(role.Role)
+	if userRole == role.SuperAdmin {
+		return true
+	}
+	userStoreID, ok := r.Context().Value(middleware.UserStoreIDKey).(int64)
+	return ok && userStoreID == storeID
+}
+
+func (h *storeHandler) Update(w http.ResponseWriter, r *http.Request) {
+	storeID, err := strconv.ParseInt(chi.URLParam(r, "storeID"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID da loja inválido", http.StatusBadRequest)
+		return
+	}
+
+	var req UpdateStoreRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Corpo da requisição inválido", http.StatusBadRequest)
+		return
+	}
+
+	details, err := h.service.Update(r.Context(), storeID, req)
+	if err != nil {
+		var validationErr *ValidationError
+		switch {
+		case errors.As(err, &validationErr):
+			writeValidationError(w, http.StatusBadRequest, validationErr)
+		case errors.Is(err, ErrStoreNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			log.Printf("Erro ao atualizar a loja: %v", err)
+			http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(details)
+}
+
+// nearbyListOptions só aceita limit e offset: a ordem é sempre pela distância
+var nearbyListOptions = pagination.Options{}
+
+// Nearby busca as lojas perto de ?lat=&lng= ou de ?cep=, dentro de ?radius_km=.
+func (h *storeHandler) Nearby(w http.ResponseWriter, r *http.Request) {
+	query, ok, err := ParseNearbyQuery(r)
+	if err != nil {
+		writeNearbyError(w, err)
+		return
+	}
+	if !ok {
+		writeValidationError(w, http.StatusBadRequest, &ValidationError{Field: "lat", Code: CodeRequired, Message: "informe lat e lng ou um CEP"})
+		return
+	}
+
+	params, err := pagination.Parse(r, nearbyListOptions)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stores, err := h.service.Nearby(r.Context(), query, params)
+	if err != nil {
+		writeNearbyError(w, err)
+		return
+	}
+
+	stores.SetLinks(w, r)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(stores)
+}
+
+func writeNearbyError(w http.ResponseWriter, err error) {
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		writeValidationError(w, http.StatusBadRequest, validationErr)
+		return
+	}
+	log.Printf("Erro ao buscar lojas próximas: %v", err)
+	http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+}
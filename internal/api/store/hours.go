@@ -0,0 +1,99 @@
+package store
+
+import "time"
+
+const (
+	clockLayout = "15:04"
+	dateLayout  = "2006-01-02"
+)
+
+// OpeningHours é um intervalo do horário semanal. Closes menor que Opens
+// indica que a loja fecha depois da meia-noite.
+type OpeningHours struct {
+	Weekday int    `json:"weekday"` // 0 = domingo
+	Opens   string `json:"opens"`   // "08:00"
+	Closes  string `json:"closes"`  // "22:00"
+}
+
+// HoursException substitui o horário semanal numa data (feriado, inventário...).
+type HoursException struct {
+	Date   string  `json:"date"` // "2025-12-25"
+	Closed bool    `json:"closed"`
+	Opens  *string `json:"opens,omitempty"`
+	Closes *string `json:"closes,omitempty"`
+	Note   string  `json:"note,omitempty"`
+}
+
+// interval guarda abertura e fechamento em minutos desde a meia-noite.
+type interval struct {
+	opens, closes int
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse(clockLayout, s)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func appendInterval(intervals []interval, opens, closes string) []interval {
+	o, err := parseClock(opens)
+	if err != nil {
+		return intervals
+	}
+	c, err := parseClock(closes)
+	if err != nil {
+		return intervals
+	}
+	return append(intervals, interval{opens: o, closes: c})
+}
+
+// intervalsOn devolve os intervalos de funcionamento de um dia. Uma exceção
+// para a data vale no lugar do horário semanal.
+func intervalsOn(day time.Time, hours []OpeningHours, exceptions map[string]HoursException) []interval {
+	if ex, ok := exceptions[day.Format(dateLayout)]; ok {
+		if ex.Closed || ex.Opens == nil || ex.Closes == nil {
+			return nil
+		}
+		return appendInterval(nil, *ex.Opens, *ex.Closes)
+	}
+
+	var intervals []interval
+	for _, h := range hours {
+		if h.Weekday == int(day.Weekday()) {
+			intervals = appendInterval(intervals, h.Opens, h.Closes)
+		}
+	}
+	return intervals
+}
+
+// isOpenAt diz se a loja está aberta em now, no fuso da loja. Um intervalo que
+// passa da meia-noite continua valendo na madrugada do dia seguinte.
+func isOpenAt(now time.Time, loc *time.Location, hours []OpeningHours, exceptions []HoursException) bool {
+	now = now.In(loc)
+	minute := now.Hour()*60 + now.Minute()
+
+	byDate := make(map[string]HoursException, len(exceptions))
+	for _, ex := range exceptions {
+		byDate[ex.Date] = ex
+	}
+
+	for _, iv := range intervalsOn(now, hours, byDate) {
+		if iv.closes > iv.opens {
+			if minute >= iv.opens && minute < iv.closes {
+				return true
+			}
+		} else if minute >= iv.opens {
+			return true
+		}
+	}
+
+	for _, iv := range intervalsOn(now.AddDate(0, 0, -1), hours, byDate) {
+		if iv.closes < iv.opens && minute < iv.closes {
+			return true
+		}
+	}
+
+	return false
+}
@@ -2,11 +2,19 @@ package store
 
 import (
 	"context"
+	"errors"
+	"localiza-compra/backend/internal/api/pagination"
 
+	sq "github.com/Masterminds/squirrel"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// storeColumns são as colunas de stores na ordem lida por scanStore.
+const storeColumns = `id, name, address, created_at, cnpj, status, status_reason, reviewed_at,
+	cep, city, state, phone, latitude, longitude, timezone`
+
 type pgxRepository struct {
 	db *pgxpool.Pool
 }
@@ -18,56 +26,104 @@ func NewRepository(dbpool *pgxpool.Pool) Repository {
 }
 
 func (r *pgxRepository) Create(ctx context.Context, store Store) (Store, error) {
-	query := `INSERT INTO stores (name, address, cnpj) VALUES ($1, $2, $3) RETURNING id, created_at`
+	query := `INSERT INTO stores (name, address, cnpj) VALUES ($1, $2, $3) RETURNING id, created_at, status, timezone`
 
-	err := r.db.QueryRow(ctx, query, store.Name, store.Address, store.CNPJ).Scan(&store.ID, &store.CreatedAt)
+	err := r.db.QueryRow(ctx, query, store.Name, store.Address, store.CNPJ).Scan(&store.ID, &store.CreatedAt, &store.Status, &store.Timezone)
 	if err != nil {
+		if isCNPJConflict(err) {
+			return Store{}, ErrCNPJAlreadyInUse
+		}
 		return Store{}, err
 	}
 
 	return store, nil
 }
 
-func (r *pgxRepository) GetAll(ctx context.Context) ([]Store, error) {
-	query := `SELECT id, name, address, created_at, cnpj FROM stores`
+func (r *pgxRepository) GetAll(ctx context.Context, params pagination.Params) ([]Store, int, error) {
+	base := sq.Select().From("stores").PlaceholderFormat(sq.Dollar)
 
-	rows, err := r.db.Query(ctx, query)
+	total, err := pagination.Count(ctx, r.db, params.Filter(base.Columns("COUNT(*)")))
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+
+	query, args, err := params.Apply(base.Columns(storeColumns)).ToSql()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
 	}
 
 	defer rows.Close()
 
-	var stores []Store
+	stores := make([]Store, 0)
 
 	for rows.Next() {
-		var s Store
-		err := rows.Scan(&s.ID, &s.Name, &s.Address, &s.CreatedAt, &s.CNPJ)
-
+		s, err := scanStore(rows)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 
 		stores = append(stores, s)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	return stores, nil
+	return stores, total, nil
 }
 
 func (r *pgxRepository) CreateWithTx(ctx context.Context, tx pgx.Tx, store Store) (Store, error) {
 	query := `
 		INSERT INTO stores (name, address, cnpj)
 		VALUES ($1, $2, $3)
-		RETURNING id, created_at`
+		RETURNING id, created_at, status, timezone`
 
-	err := tx.QueryRow(ctx, query, store.Name, store.Address, store.CNPJ).Scan(&store.ID, &store.CreatedAt)
+	err := tx.QueryRow(ctx, query, store.Name, store.Address, store.CNPJ).Scan(&store.ID, &store.CreatedAt, &store.Status, &store.Timezone)
 	if err != nil {
+		if isCNPJConflict(err) {
+			return Store{}, ErrCNPJAlreadyInUse
+		}
 		return Store{}, err
 	}
 
 	return store, nil
 }
+
+func (r *pgxRepository) GetByID(ctx context.Context, id int64) (Store, error) {
+	query := `SELECT ` + storeColumns + ` FROM stores WHERE id = $1`
+
+	s, err := scanStore(r.db.QueryRow(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Store{}, ErrStoreNotFound
+		}
+		return Store{}, err
+	}
+
+	return s, nil
+}
+
+// isCNPJConflict reconhece a violação do índice único de stores.cnpj.
+func isCNPJConflict(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "stores_cnpj_key"
+}
+
+// storeFields são os destinos do Scan na ordem de storeColumns.
+func storeFields(s *Store) []any {
+	return []any{
+		&s.ID, &s.Name, &s.Address, &s.CreatedAt, &s.CNPJ, &s.Status, &s.StatusReason, &s.ReviewedAt,
+		&s.CEP, &s.City, &s.State, &s.Phone, &s.Latitude, &s.Longitude, &s.Timezone,
+	}
+}
+
+func scanStore(row pgx.Row) (Store, error) {
+	var s Store
+	err := row.Scan(storeFields(&s)...)
+	return s, err
+}
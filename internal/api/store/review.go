@@ -0,0 +1,152 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"localiza-compra/backend/internal/api/pagination"
+	"localiza-compra/backend/internal/api/role"
+	"localiza-compra/backend/internal/mailer"
+	"log"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+)
+
+// Status é a situação da loja na aprovação. Só lojas aprovadas aparecem na
+// listagem pública e na otimização das listas de compras.
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusApproved  Status = "approved"
+	StatusRejected  Status = "rejected"
+	StatusSuspended Status = "suspended"
+)
+
+var (
+	ErrStoreNotFound           = errors.New("loja não encontrada")
+	ErrInvalidStatusTransition = errors.New("a loja não pode passar para esta situação a partir da atual")
+	ErrReasonRequired          = errors.New("informe o motivo")
+)
+
+// statusTransitions diz de quais situações cada decisão pode partir.
+var statusTransitions = map[Status][]Status{
+	StatusApproved:  {StatusPending, StatusSuspended, StatusRejected},
+	StatusRejected:  {StatusPending},
+	StatusSuspended: {StatusApproved},
+}
+
+type ReviewStoreRequest struct {
+	Reason string `json:"reason"`
+}
+
+// UpdateStatus muda a situação só se a atual estiver em from, para duas
+// decisões simultâneas não passarem por cima uma da outra.
+func (r *pgxRepository) UpdateStatus(ctx context.Context, storeID int64, from []Status, to Status, reason *string, reviewedBy int64) (Store, error) {
+	query := `UPDATE stores
+			SET status = $2, status_reason = $3, reviewed_at = NOW(), reviewed_by = $4
+			WHERE id = $1 AND status = ANY($5)
+			RETURNING ` + storeColumns
+
+	fromText := make([]string, len(from))
+	for i, f := range from {
+		fromText[i] = string(f)
+	}
+
+	s, err := scanStore(r.db.QueryRow(ctx, query, storeID, to, reason, reviewedBy, fromText))
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return Store{}, err
+		}
+		// Ou a loja não existe, ou está numa situação que não permite a mudança
+		if _, err := r.GetByID(ctx, storeID); err != nil {
+			return Store{}, err
+		}
+		return Store{}, ErrInvalidStatusTransition
+	}
+
+	return s, nil
+}
+
+// ListForReview lista as lojas em qualquer situação, para os super admins.
+func (s *storeService) ListForReview(ctx context.Context, params pagination.Params) (pagination.Page[Store], error) {
+	stores, total, err := s.repo.GetAll(ctx, params)
+	if err != nil {
+		return pagination.Page[Store]{}, err
+	}
+	return pagination.NewPage(stores, total, params), nil
+}
+
+func (s *storeService) GetByID(ctx context.Context, id int64) (Store, error) {
+	return s.repo.GetByID(ctx, id)
+}
+
+// Review aplica a decisão do super admin e avisa os administradores da loja.
+func (s *storeService) Review(ctx context.Context, storeID, reviewerID int64, to Status, reason string) (Store, error) {
+	from, ok := statusTransitions[to]
+	if !ok {
+		return Store{}, ErrInvalidStatusTransition
+	}
+
+	var reasonPtr *string
+	if reason = strings.TrimSpace(reason); reason != "" {
+		reasonPtr = &reason
+	}
+	if to != StatusApproved && reasonPtr == nil {
+		return Store{}, ErrReasonRequired
+	}
+
+	store, err := s.repo.UpdateStatus(ctx, storeID, from, to, reasonPtr, reviewerID)
+	if err != nil {
+		return Store{}, err
+	}
+
+	// A decisão já está gravada; uma falha no e-mail só vai para o log
+	if err := s.notifyReview(ctx, store); err != nil {
+		log.Printf("Erro ao avisar os administradores da loja %d: %v", store.ID, err)
+	}
+
+	return store, nil
+}
+
+func (s *storeService) notifyReview(ctx context.Context, store Store) error {
+	admins, _, err := s.userRepo.List(ctx, pagination.Params{
+		Limit: pagination.MaxLimit,
+		Where: []sq.Sqlizer{sq.Eq{"store_id": store.ID}, sq.Eq{"role": role.StoreAdmin}},
+	})
+	if err != nil {
+		return err
+	}
+
+	var subject, body string
+	switch store.Status {
+	case StatusApproved:
+		subject = fmt.Sprintf("A loja %s foi aprovada", store.Name)
+		body = "A sua loja já aparece para os clientes do Localiza Compra."
+	case StatusRejected:
+		subject = fmt.Sprintf("O cadastro da loja %s foi recusado", store.Name)
+		body = "O cadastro da sua loja não foi aprovado."
+	case StatusSuspended:
+		subject = fmt.Sprintf("A loja %s foi suspensa", store.Name)
+		body = "A sua loja deixou de aparecer para os clientes do Localiza Compra."
+	}
+	if store.StatusReason != nil {
+		body += "\n\nMotivo: " + *store.StatusReason
+	}
+
+	var errs []error
+	for _, admin := range admins {
+		err := s.mailer.Send(ctx, mailer.Message{
+			To:      admin.Email,
+			Subject: subject,
+			Body:    fmt.Sprintf("Olá, %s!\n\n%s\n", admin.Name, body),
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -2,9 +2,14 @@ package store
 
 import (
 	"context"
-	"errors"
+	"localiza-compra/backend/internal/api/pagination"
+	"localiza-compra/backend/internal/api/role"
 	"localiza-compra/backend/internal/api/user"
+	"localiza-compra/backend/internal/geocoder"
+	"localiza-compra/backend/internal/mailer"
+	"strings"
 
+	sq "github.com/Masterminds/squirrel"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -13,49 +18,66 @@ type storeService struct {
 	db       *pgxpool.Pool
 	repo     Repository
 	userRepo user.Repository
+	mailer   mailer.Mailer
+	geocoder geocoder.Geocoder
+	// inviteSecret assina os tokens de convite da equipe
+	inviteSecret []byte
+	appURL       string
 }
 
-func NewService(db *pgxpool.Pool, r Repository, ur user.Repository) Service {
+func NewService(db *pgxpool.Pool, r Repository, ur user.Repository, m mailer.Mailer, g geocoder.Geocoder, inviteSecret []byte, appURL string) Service {
 	return &storeService{
-		db:       db,
-		repo:     r,
-		userRepo: ur,
+		db:           db,
+		repo:         r,
+		userRepo:     ur,
+		mailer:       m,
+		geocoder:     g,
+		inviteSecret: inviteSecret,
+		appURL:       strings.TrimRight(appURL, "/"),
 	}
 }
 
 func (s *storeService) Create(ctx context.Context, store Store) (Store, error) {
-	if store.Name == "" {
-		return Store{}, errors.New("o nome da loja não pode ser vazia")
-	}
-	if store.Address == "" {
-		return Store{}, errors.New("o endereço da loja não pode ser vazio")
+	if err := requireField("name", store.Name, "o nome da loja não pode ser vazio"); err != nil {
+		return Store{}, err
 	}
-	if store.CNPJ == "" {
-		return Store{}, errors.New("o CNPJ da loja não pode ser vazio")
+	if err := requireField("address", store.Address, "o endereço da loja não pode ser vazio"); err != nil {
+		return Store{}, err
 	}
-	if len(store.CNPJ) != 14 {
-		return Store{}, errors.New("o CNPJ da loja precisa ter 14 caracteres")
+
+	normalized, err := normalizeCNPJ("cnpj", store.CNPJ)
+	if err != nil {
+		return Store{}, err
 	}
+	store.CNPJ = normalized
+
 	return s.repo.Create(ctx, store)
 }
 
-func (s *storeService) GetAll(ctx context.Context) ([]Store, error) {
-	return s.repo.GetAll(ctx)
+// GetAll lista só as lojas aprovadas; as demais ficam em ListForReview.
+func (s *storeService) GetAll(ctx context.Context, params pagination.Params) (pagination.Page[Store], error) {
+	params.Where = append(params.Where, sq.Eq{"status": StatusApproved})
+
+	stores, total, err := s.repo.GetAll(ctx, params)
+	if err != nil {
+		return pagination.Page[Store]{}, err
+	}
+	return pagination.NewPage(stores, total, params), nil
 }
 
 func (s *storeService) CreateStoreWithAdmin(ctx context.Context, req StoreWithAdminRequest) (Store, error) {
-	if req.StoreName == "" {
-		return Store{}, errors.New("o nome da loja não pode ser vazia")
-	}
-	if req.StoreAddress == "" {
-		return Store{}, errors.New("o endereço da loja não pode ser vazio")
+	if err := requireField("store_name", req.StoreName, "o nome da loja não pode ser vazio"); err != nil {
+		return Store{}, err
 	}
-	if req.CNPJ == "" {
-		return Store{}, errors.New("o CNPJ da loja não pode ser vazio")
+	if err := requireField("store_address", req.StoreAddress, "o endereço da loja não pode ser vazio"); err != nil {
+		return Store{}, err
 	}
-	if len(req.CNPJ) != 14 {
-		return Store{}, errors.New("o CNPJ da loja precisa ter 14 caracteres")
+
+	normalized, err := normalizeCNPJ("cnpj", req.CNPJ)
+	if err != nil {
+		return Store{}, err
 	}
+
 	tx, err := s.db.Begin(ctx)
 	if err != nil {
 		return Store{}, err
@@ -66,7 +88,7 @@ func (s *storeService) CreateStoreWithAdmin(ctx context.Context, req StoreWithAd
 	storeToCreate := Store{
 		Name:    req.StoreName,
 		Address: req.StoreAddress,
-		CNPJ:    req.CNPJ,
+		CNPJ:    normalized,
 	}
 
 	createdStore, err := s.repo.CreateWithTx(ctx, tx, storeToCreate)
@@ -84,7 +106,7 @@ func (s *storeService) CreateStoreWithAdmin(ctx context.Context, req StoreWithAd
 		Email:        req.Admin.Email,
 		PasswordHash: string(hashedPassword),
 		Phone:        req.Admin.Phone,
-		Role:         "store_admin",
+		Role:         role.StoreAdmin,
 		StoreID:      &createdStore.ID,
 	}
 
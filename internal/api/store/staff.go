@@ -0,0 +1,310 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"localiza-compra/backend/internal/api/pagination"
+	"localiza-compra/backend/internal/api/role"
+	"localiza-compra/backend/internal/api/securetoken"
+	"localiza-compra/backend/internal/api/user"
+	"localiza-compra/backend/internal/mailer"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	invitationPurpose = "store_invitation"
+	invitationTTL     = 7 * 24 * time.Hour
+)
+
+var (
+	ErrInvitationNotFound      = errors.New("convite não encontrado")
+	ErrInvalidEmail            = errors.New("e-mail inválido")
+	ErrInvalidInvitationRole   = errors.New("só é possível convidar para store_admin ou stock_clerk")
+	ErrInvitationEmailMismatch = errors.New("o convite foi enviado para outro e-mail")
+	ErrAlreadyStaff            = errors.New("o usuário já faz parte da equipe de uma loja")
+	ErrNotStaff                = errors.New("o usuário não faz parte da equipe desta loja")
+	// A checagem é feita em user.ChangeRoleWithTx, junto da troca de cargo
+	ErrLastStoreAdmin = user.ErrLastStoreAdmin
+)
+
+type Invitation struct {
+	ID        int64     `json:"id"`
+	StoreID   int64     `json:"store_id"`
+	Email     string    `json:"email"`
+	Role      role.Role `json:"role"`
+	InvitedBy *int64    `json:"invited_by"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type InviteRequest struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+type AcceptInvitationRequest struct {
+	Token string `json:"token"`
+}
+
+// CreateInvitation grava o convite e cancela os convites pendentes para o
+// mesmo e-mail na mesma loja, para só o último link valer.
+func (r *pgxRepository) CreateInvitation(ctx context.Context, inv Invitation, tokenHash string) (Invitation, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return Invitation{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		UPDATE store_invitations SET revoked_at = NOW()
+		WHERE store_id = $1 AND lower(email) = lower($2) AND accepted_at IS NULL AND revoked_at IS NULL`,
+		inv.StoreID, inv.Email)
+	if err != nil {
+		return Invitation{}, err
+	}
+
+	query := `
+		INSERT INTO store_invitations (store_id, email, role, token_hash, invited_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`
+
+	err = tx.QueryRow(ctx, query, inv.StoreID, inv.Email, inv.Role, tokenHash, inv.InvitedBy, inv.ExpiresAt).Scan(&inv.ID, &inv.CreatedAt)
+	if err != nil {
+		return Invitation{}, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return Invitation{}, err
+	}
+
+	return inv, nil
+}
+
+// ListPendingInvitations lista os convites que ainda podem ser aceitos.
+func (r *pgxRepository) ListPendingInvitations(ctx context.Context, storeID int64) ([]Invitation, error) {
+	query := `SELECT id, store_id, email, role, invited_by, created_at, expires_at
+			FROM store_invitations
+			WHERE store_id = $1 AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > NOW()
+			ORDER BY created_at DESC`
+
+	rows, err := r.db.Query(ctx, query, storeID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	invitations := make([]Invitation, 0)
+
+	for rows.Next() {
+		var inv Invitation
+
+		err := rows.Scan(&inv.ID, &inv.StoreID, &inv.Email, &inv.Role, &inv.InvitedBy, &inv.CreatedAt, &inv.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+
+		invitations = append(invitations, inv)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return invitations, nil
+}
+
+func (r *pgxRepository) RevokeInvitation(ctx context.Context, storeID, invitationID int64) error {
+	query := `UPDATE store_invitations SET revoked_at = NOW()
+			WHERE id = $1 AND store_id = $2 AND accepted_at IS NULL AND revoked_at IS NULL`
+
+	tag, err := r.db.Exec(ctx, query, invitationID, storeID)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrInvitationNotFound
+	}
+
+	return nil
+}
+
+// GetPendingInvitationWithTx busca e trava um convite ainda válido pelo hash do token.
+func (r *pgxRepository) GetPendingInvitationWithTx(ctx context.Context, tx pgx.Tx, tokenHash string) (Invitation, error) {
+	query := `SELECT id, store_id, email, role, invited_by, created_at, expires_at
+			FROM store_invitations
+			WHERE token_hash = $1 AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > NOW()
+			FOR UPDATE`
+
+	var inv Invitation
+
+	err := tx.QueryRow(ctx, query, tokenHash).Scan(&inv.ID, &inv.StoreID, &inv.Email, &inv.Role, &inv.InvitedBy, &inv.CreatedAt, &inv.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Invitation{}, ErrInvitationNotFound
+		}
+		return Invitation{}, err
+	}
+
+	return inv, nil
+}
+
+func (r *pgxRepository) MarkInvitationAcceptedWithTx(ctx context.Context, tx pgx.Tx, invitationID, userID int64) error {
+	_, err := tx.Exec(ctx, `UPDATE store_invitations SET accepted_at = NOW(), accepted_by = $2 WHERE id = $1`, invitationID, userID)
+	return err
+}
+
+// Invite convida um e-mail para a equipe da loja e envia o link do convite.
+func (s *storeService) Invite(ctx context.Context, storeID, invitedBy int64, req InviteRequest) (Invitation, error) {
+	address, err := mail.ParseAddress(strings.TrimSpace(req.Email))
+	if err != nil || address.Name != "" {
+		return Invitation{}, ErrInvalidEmail
+	}
+
+	staffRole, err := role.Parse(req.Role)
+	if err != nil || !staffRole.RequiresStore() {
+		return Invitation{}, ErrInvalidInvitationRole
+	}
+
+	store, err := s.repo.GetByID(ctx, storeID)
+	if err != nil {
+		return Invitation{}, err
+	}
+
+	existing, err := s.userRepo.GetByEmail(ctx, address.Address)
+	if err == nil && existing.StoreID != nil && *existing.StoreID == storeID && existing.Role.RequiresStore() {
+		return Invitation{}, ErrAlreadyStaff
+	}
+	if err != nil && !errors.Is(err, user.ErrUserNotFound) {
+		return Invitation{}, err
+	}
+
+	token, hash, err := securetoken.NewSigned(s.inviteSecret, invitationPurpose)
+	if err != nil {
+		return Invitation{}, err
+	}
+
+	inv, err := s.repo.CreateInvitation(ctx, Invitation{
+		StoreID:   storeID,
+		Email:     address.Address,
+		Role:      staffRole,
+		InvitedBy: &invitedBy,
+		ExpiresAt: time.Now().Add(invitationTTL),
+	}, hash)
+	if err != nil {
+		return Invitation{}, err
+	}
+
+	err = s.mailer.Send(ctx, mailer.Message{
+		To:      inv.Email,
+		Subject: fmt.Sprintf("Convite para a equipe de %s", store.Name),
+		Body: fmt.Sprintf("Olá!\n\nVocê foi convidado para a equipe da loja %s no Localiza Compra, com o cargo %s.\n\nPara aceitar, entre (ou crie uma conta) com este e-mail e abra o link abaixo em até %d dias:\n\n%s/convites/aceitar?token=%s\n",
+			store.Name, inv.Role, int(invitationTTL.Hours()/24), s.appURL, url.QueryEscape(token)),
+	})
+	if err != nil {
+		return Invitation{}, err
+	}
+
+	return inv, nil
+}
+
+func (s *storeService) ListInvitations(ctx context.Context, storeID int64) ([]Invitation, error) {
+	return s.repo.ListPendingInvitations(ctx, storeID)
+}
+
+func (s *storeService) RevokeInvitation(ctx context.Context, storeID, invitationID int64) error {
+	return s.repo.RevokeInvitation(ctx, storeID, invitationID)
+}
+
+// AcceptInvitation vincula o usuário logado à loja do convite. O convite só
+// vale para o e-mail convidado e é marcado como aceito na mesma transação da
+// troca de cargo.
+func (s *storeService) AcceptInvitation(ctx context.Context, userID int64, token string) (Invitation, error) {
+	hash, err := securetoken.VerifySigned(s.inviteSecret, invitationPurpose, token)
+	if err != nil {
+		return Invitation{}, ErrInvitationNotFound
+	}
+
+	u, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return Invitation{}, err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return Invitation{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	inv, err := s.repo.GetPendingInvitationWithTx(ctx, tx, hash)
+	if err != nil {
+		return Invitation{}, err
+	}
+
+	if !strings.EqualFold(inv.Email, u.Email) {
+		return Invitation{}, ErrInvitationEmailMismatch
+	}
+	// Super admins já acessam todas as lojas, e ninguém participa de duas equipes
+	if u.Role == role.SuperAdmin || (u.Role.RequiresStore() && u.StoreID != nil && *u.StoreID != inv.StoreID) {
+		return Invitation{}, ErrAlreadyStaff
+	}
+
+	err = s.userRepo.ChangeRoleWithTx(ctx, tx, user.RoleChange{
+		UserID:     u.ID,
+		ChangedBy:  inv.InvitedBy,
+		NewRole:    inv.Role,
+		NewStoreID: &inv.StoreID,
+		Source:     user.RoleChangeSourceInvitation,
+	})
+	if err != nil {
+		return Invitation{}, err
+	}
+
+	if err = s.repo.MarkInvitationAcceptedWithTx(ctx, tx, inv.ID, u.ID); err != nil {
+		return Invitation{}, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return Invitation{}, err
+	}
+
+	return inv, nil
+}
+
+func (s *storeService) ListStaff(ctx context.Context, storeID int64, params pagination.Params) (pagination.Page[user.User], error) {
+	params.Where = append(params.Where, sq.Eq{"store_id": storeID}, sq.Eq{"role": []role.Role{role.StoreAdmin, role.StockClerk}})
+
+	staff, total, err := s.userRepo.List(ctx, params)
+	if err != nil {
+		return pagination.Page[user.User]{}, err
+	}
+	return pagination.NewPage(staff, total, params), nil
+}
+
+// RemoveStaff tira o usuário da equipe: ele volta a ser cliente e perde o
+// vínculo com a loja. A troca de cargo recusa remover o último administrador.
+func (s *storeService) RemoveStaff(ctx context.Context, storeID, removedBy, userID int64) error {
+	u, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if u.StoreID == nil || *u.StoreID != storeID || !u.Role.RequiresStore() {
+		return ErrNotStaff
+	}
+
+	return s.userRepo.ChangeRole(ctx, user.RoleChange{
+		UserID:    u.ID,
+		ChangedBy: &removedBy,
+		NewRole:   role.Customer,
+		Source:    user.RoleChangeSourceAPI,
+	})
+}
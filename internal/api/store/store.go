@@ -2,6 +2,9 @@ package store
 
 import (
 	"context"
+	"localiza-compra/backend/internal/api/pagination"
+	"localiza-compra/backend/internal/api/user"
+	"localiza-compra/backend/internal/geocoder"
 	"time"
 
 	"github.com/jackc/pgx/v5"
@@ -13,6 +16,19 @@ type Store struct {
 	Address   string    `json:"address"`
 	CreatedAt time.Time `json:"created_at"`
 	CNPJ      string    `json:"cnpj"`
+	Status    Status    `json:"status"`
+	// Motivo da rejeição ou suspensão, mostrado ao administrador da loja
+	StatusReason *string    `json:"status_reason,omitempty"`
+	ReviewedAt   *time.Time `json:"reviewed_at,omitempty"`
+	// Endereço estruturado; Address fica com logradouro, número e complemento
+	CEP       *string  `json:"cep,omitempty"`
+	City      *string  `json:"city,omitempty"`
+	State     *string  `json:"state,omitempty"`
+	Phone     *string  `json:"phone,omitempty"`
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+	// Fuso horário IANA usado nos horários de funcionamento
+	Timezone string `json:"timezone"`
 }
 
 type CreateStoreRequest struct {
@@ -31,18 +47,47 @@ type AdminDataRequest struct {
 type StoreWithAdminRequest struct {
 	StoreName    string           `json:"store_name"`
 	StoreAddress string           `json:"store_address"`
-	CNPJ         string           `json:"cpnj"`
+	CNPJ         string           `json:"cnpj"`
 	Admin        AdminDataRequest `json:"admin"`
 }
 
 type Repository interface {
 	Create(ctx context.Context, store Store) (Store, error)
 	CreateWithTx(ctx context.Context, tx pgx.Tx, store Store) (Store, error)
-	GetAll(ctx context.Context) ([]Store, error)
+	GetAll(ctx context.Context, params pagination.Params) ([]Store, int, error)
+	GetByID(ctx context.Context, id int64) (Store, error)
+	GetOpeningHours(ctx context.Context, storeID int64) ([]OpeningHours, error)
+	GetHourExceptions(ctx context.Context, storeID int64, from string) ([]HoursException, error)
+	Update(ctx context.Context, storeID int64, req UpdateStoreRequest) error
+	GetNearby(ctx context.Context, p geocoder.Point, radiusKm float64, params pagination.Params) ([]NearbyStore, int, error)
+	GetNearbyIDs(ctx context.Context, p geocoder.Point, radiusKm float64) ([]int64, error)
+
+	CreateInvitation(ctx context.Context, inv Invitation, tokenHash string) (Invitation, error)
+	ListPendingInvitations(ctx context.Context, storeID int64) ([]Invitation, error)
+	RevokeInvitation(ctx context.Context, storeID, invitationID int64) error
+	GetPendingInvitationWithTx(ctx context.Context, tx pgx.Tx, tokenHash string) (Invitation, error)
+	MarkInvitationAcceptedWithTx(ctx context.Context, tx pgx.Tx, invitationID, userID int64) error
+
+	UpdateStatus(ctx context.Context, storeID int64, from []Status, to Status, reason *string, reviewedBy int64) (Store, error)
 }
 
 type Service interface {
 	Create(ctx context.Context, store Store) (Store, error)
 	CreateStoreWithAdmin(ctx context.Context, req StoreWithAdminRequest) (Store, error)
-	GetAll(ctx context.Context) ([]Store, error)
+	GetAll(ctx context.Context, params pagination.Params) (pagination.Page[Store], error)
+	GetDetails(ctx context.Context, id int64) (StoreDetails, error)
+	Update(ctx context.Context, storeID int64, req UpdateStoreRequest) (StoreDetails, error)
+	Nearby(ctx context.Context, q NearbyQuery, params pagination.Params) (pagination.Page[NearbyStore], error)
+	NearbyIDs(ctx context.Context, q NearbyQuery) ([]int64, error)
+
+	Invite(ctx context.Context, storeID, invitedBy int64, req InviteRequest) (Invitation, error)
+	ListInvitations(ctx context.Context, storeID int64) ([]Invitation, error)
+	RevokeInvitation(ctx context.Context, storeID, invitationID int64) error
+	AcceptInvitation(ctx context.Context, userID int64, token string) (Invitation, error)
+	ListStaff(ctx context.Context, storeID int64, params pagination.Params) (pagination.Page[user.User], error)
+	RemoveStaff(ctx context.Context, storeID, removedBy, userID int64) error
+
+	ListForReview(ctx context.Context, params pagination.Params) (pagination.Page[Store], error)
+	GetByID(ctx context.Context, id int64) (Store, error)
+	Review(ctx context.Context, storeID, reviewerID int64, to Status, reason string) (Store, error)
 }
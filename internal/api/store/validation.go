@@ -0,0 +1,58 @@
+package store
+
+import (
+	"errors"
+	"localiza-compra/backend/internal/api/cnpj"
+	"strings"
+)
+
+var ErrCNPJAlreadyInUse = errors.New("já existe uma loja cadastrada com este CNPJ")
+
+// ValidationError aponta o campo da requisição que está inválido. Code é
+// estável para o front-end traduzir; Message é o texto em português.
+type ValidationError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// Códigos de ValidationError
+const (
+	CodeRequired           = "required"
+	CodeInvalidLength      = "invalid_length"
+	CodeInvalidCharacters  = "invalid_characters"
+	CodeInvalidCheckDigits = "invalid_check_digits"
+	CodeAlreadyInUse       = "already_in_use"
+)
+
+func requireField(field, value, message string) error {
+	if strings.TrimSpace(value) == "" {
+		return &ValidationError{Field: field, Code: CodeRequired, Message: message}
+	}
+	return nil
+}
+
+// normalizeCNPJ tira a máscara e valida o CNPJ, devolvendo o erro já no
+// formato de ValidationError.
+func normalizeCNPJ(field, value string) (string, error) {
+	normalized, err := cnpj.Normalize(value)
+	if err == nil {
+		return normalized, nil
+	}
+
+	code := CodeInvalidCheckDigits
+	switch {
+	case errors.Is(err, cnpj.ErrEmpty):
+		code = CodeRequired
+	case errors.Is(err, cnpj.ErrInvalidLength):
+		code = CodeInvalidLength
+	case errors.Is(err, cnpj.ErrInvalidCharacters):
+		code = CodeInvalidCharacters
+	}
+
+	return "", &ValidationError{Field: field, Code: code, Message: err.Error()}
+}
@@ -0,0 +1,306 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"localiza-compra/backend/internal/api/role"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	ErrEmailAlreadyInUse = errors.New("o email já está em uso")
+	ErrWrongPassword     = errors.New("senha atual incorreta")
+)
+
+type UpdateUserRequest struct {
+	Name  *string `json:"name"`
+	Phone *string `json:"phone"`
+}
+
+// ChangeEmailRequest pede a troca de e-mail; ela só vale depois que o novo
+// endereço for confirmado pelo link enviado a ele.
+type ChangeEmailRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type ChangeEmailConfirmRequest struct {
+	Token string `json:"token"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
+// DataExport reúne os dados pessoais do usuário guardados pela aplicação
+// (direito de acesso da LGPD).
+type DataExport struct {
+	ExportedAt    time.Time         `json:"exported_at"`
+	Profile       ExportedProfile   `json:"profile"`
+	Sessions      []ExportedSession `json:"sessions"`
+	ShoppingLists []ExportedList    `json:"shopping_lists"`
+}
+
+type ExportedProfile struct {
+	ID              int64      `json:"id"`
+	Name            string     `json:"name"`
+	Email           string     `json:"email"`
+	Phone           string     `json:"phone"`
+	Role            role.Role  `json:"role"`
+	StoreID         *int64     `json:"store_id"`
+	CreatedAt       time.Time  `json:"created_at"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+}
+
+type ExportedSession struct {
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt time.Time  `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+}
+
+type ExportedList struct {
+	ID        int64              `json:"id"`
+	Name      string             `json:"name"`
+	CreatedAt time.Time          `json:"created_at"`
+	Items     []ExportedListItem `json:"items"`
+}
+
+// ExportedListItem tem ProductID nulo nos itens em texto livre; ProductName
+// traz então o texto digitado.
+type ExportedListItem struct {
+	ProductID   *int64  `json:"product_id"`
+	ProductName string  `json:"product_name"`
+	Note        *string `json:"note"`
+	Quantity    int     `json:"quantity"`
+	IsChecked   bool    `json:"is_checked"`
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+func (r *pgxRepository) PartialUpdate(ctx context.Context, id int64, req UpdateUserRequest) error {
+	updateBuilder := sq.Update("users").
+		Where(sq.Eq{"id": id}).
+		PlaceholderFormat(sq.Dollar)
+	if req.Name != nil {
+		updateBuilder = updateBuilder.Set("name", *req.Name)
+	}
+	if req.Phone != nil {
+		updateBuilder = updateBuilder.Set("phone", *req.Phone)
+	}
+
+	sql, args, err := updateBuilder.ToSql()
+	if err != nil {
+		return err
+	}
+
+	tag, err := r.db.Exec(ctx, sql, args...)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// UpdatePassword troca a senha e encerra as outras sessões, mantendo só
+// keepSessionID (a sessão de quem fez a troca).
+func (r *pgxRepository) UpdatePassword(ctx context.Context, id int64, passwordHash string, keepSessionID int64) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `UPDATE users SET password_hash = $1 WHERE id = $2`, passwordHash, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE user_sessions SET revoked_at = NOW()
+		WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL`, id, keepSessionID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ChangeEmail aplica a troca de e-mail pedida no token. O novo endereço já
+// nasce confirmado, pois o link só chega a quem tem acesso a ele.
+func (r *pgxRepository) ChangeEmail(ctx context.Context, tokenHash string) (int64, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	userID, email, err := consumeToken(ctx, tx, TokenPurposeEmailChange, tokenHash)
+	if err != nil {
+		return 0, err
+	}
+	if email == "" {
+		return 0, ErrInvalidToken
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE users SET email = $1, email_verified_at = NOW() WHERE id = $2`, email, userID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return 0, ErrEmailAlreadyInUse
+		}
+		return 0, err
+	}
+
+	// Links de confirmação ainda abertos eram para o e-mail antigo
+	_, err = tx.Exec(ctx, `
+		UPDATE user_tokens SET used_at = NOW()
+		WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`, userID, TokenPurposeEmailVerification)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// Delete remove o usuário, com as mesmas travas da troca de cargo: o último
+// super admin e o último administrador de uma loja não podem sair. Sessões,
+// tokens e listas de compras (com os itens) são apagados em cascata pelo banco.
+func (r *pgxRepository) Delete(ctx context.Context, id int64) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var current role.Role
+	var storeID *int64
+	err = tx.QueryRow(ctx, `SELECT role, store_id FROM users WHERE id = $1 FOR UPDATE`, id).Scan(&current, &storeID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+
+	if err = guardLastAdmins(ctx, tx, current, storeID, "", nil); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(ctx, `DELETE FROM users WHERE id = $1`, id); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (r *pgxRepository) Export(ctx context.Context, id int64) (DataExport, error) {
+	user, err := r.GetByID(ctx, id)
+	if err != nil {
+		return DataExport{}, err
+	}
+
+	export := DataExport{
+		ExportedAt: time.Now(),
+		Profile: ExportedProfile{
+			ID:              user.ID,
+			Name:            user.Name,
+			Email:           user.Email,
+			Phone:           user.Phone,
+			Role:            user.Role,
+			StoreID:         user.StoreID,
+			CreatedAt:       user.CreatedAt,
+			EmailVerifiedAt: user.EmailVerifiedAt,
+		},
+		Sessions:      make([]ExportedSession, 0),
+		ShoppingLists: make([]ExportedList, 0),
+	}
+
+	rows, err := r.db.Query(ctx, `
+		SELECT created_at, last_used_at, expires_at, revoked_at, user_agent, ip
+		FROM user_sessions WHERE user_id = $1 ORDER BY created_at`, id)
+	if err != nil {
+		return DataExport{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s ExportedSession
+		if err := rows.Scan(&s.CreatedAt, &s.LastUsedAt, &s.ExpiresAt, &s.RevokedAt, &s.UserAgent, &s.IP); err != nil {
+			return DataExport{}, err
+		}
+		export.Sessions = append(export.Sessions, s)
+	}
+	if err = rows.Err(); err != nil {
+		return DataExport{}, err
+	}
+
+	rows, err = r.db.Query(ctx, `
+		SELECT sl.id, sl.name, sl.created_at, sli.id, sli.product_id, COALESCE(p.name, sli.name), sli.note, sli.quantity, sli.is_checked
+		FROM shopping_lists sl
+		LEFT JOIN shopping_list_items sli ON sli.shopping_list_id = sl.id
+		LEFT JOIN products p ON p.id = sli.product_id
+		WHERE sl.user_id = $1
+		ORDER BY sl.created_at, sl.id, sli.id`, id)
+	if err != nil {
+		return DataExport{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var list ExportedList
+		var itemID *int64
+		var productID *int64
+		var productName *string
+		var note *string
+		var quantity *int
+		var isChecked *bool
+		if err := rows.Scan(&list.ID, &list.Name, &list.CreatedAt, &itemID, &productID, &productName, &note, &quantity, &isChecked); err != nil {
+			return DataExport{}, err
+		}
+
+		n := len(export.ShoppingLists)
+		if n == 0 || export.ShoppingLists[n-1].ID != list.ID {
+			list.Items = make([]ExportedListItem, 0)
+			export.ShoppingLists = append(export.ShoppingLists, list)
+			n++
+		}
+		// Lista sem itens vem do LEFT JOIN com as colunas do item nulas
+		if itemID != nil {
+			item := ExportedListItem{ProductID: productID, Note: note, Quantity: *quantity, IsChecked: *isChecked}
+			if productName != nil {
+				item.ProductName = *productName
+			}
+			export.ShoppingLists[n-1].Items = append(export.ShoppingLists[n-1].Items, item)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return DataExport{}, err
+	}
+
+	return export, nil
+}
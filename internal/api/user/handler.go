@@ -3,19 +3,36 @@ package user
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"localiza-compra/backend/internal/api/middleware"
+	"localiza-compra/backend/internal/api/pagination"
+	"localiza-compra/backend/internal/api/role"
 	"log"
+	"net"
 	"net/http"
-	"time"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	accessCookieName  = "token"
+	refreshCookieName = "refresh_token"
+	// O refresh token só precisa ir para as rotas de sessão
+	refreshCookiePath = "/api/v1"
 )
 
 type userHandler struct {
-	service Service
+	service       Service
+	secureCookies bool
 }
 
-func NewHandler(s Service) *userHandler {
+// NewHandler cria o handler de usuários. secureCookies liga a flag Secure dos
+// cookies de sessão, o que exige HTTPS (produção).
+func NewHandler(s Service, secureCookies bool) *userHandler {
 	return &userHandler{
-		service: s,
+		service:       s,
+		secureCookies: secureCookies,
 	}
 }
 
@@ -37,6 +54,14 @@ func (h *userHandler) Create(w http.ResponseWriter, r *http.Request) {
 
 	createdUser, err := h.service.Create(r.Context(), userToCreate)
 	if err != nil {
+		if errors.Is(err, ErrWeakPassword) || errors.Is(err, ErrInvalidName) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, ErrEmailAlreadyInUse) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
 		log.Printf("Erro ao criar usuário: %v", err)
 		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
 		return
@@ -56,24 +81,53 @@ func (h *userHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tokenString, err := h.service.Login(r.Context(), req.Email, req.Password)
+	meta := SessionMeta{UserAgent: r.UserAgent(), IP: clientIP(r)}
+
+	tokens, err := h.service.Login(r.Context(), req.Email, req.Password, meta)
 	if err != nil {
+		if errors.Is(err, ErrInvalidCredentials) {
+			http.Error(w, "Credenciais inválidas", http.StatusUnauthorized)
+			return
+		}
 		log.Printf("Erro ao entrar na conta: %v", err)
-		http.Error(w, "Erro interno do servidor", http.StatusUnauthorized)
+		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "token",
-		Value:    tokenString,
-		Expires:  time.Now().Add(30 * 24 * time.Hour),
-		Path:     "/",
-		HttpOnly: true,
-		// Secure:   true,
-		SameSite: http.SameSiteLaxMode,
-	})
+	h.setSessionCookies(w, tokens)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(tokens)
+}
 
+// Refresh troca o refresh token do cookie por um novo par de tokens.
+func (h *userHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var refreshToken string
+	if cookie, err := r.Cookie(refreshCookieName); err == nil {
+		refreshToken = cookie.Value
+	}
+
+	tokens, err := h.service.Refresh(r.Context(), refreshToken)
+	if err != nil {
+		if errors.Is(err, ErrInvalidRefreshToken) || errors.Is(err, ErrRefreshTokenReused) {
+			if errors.Is(err, ErrRefreshTokenReused) {
+				log.Printf("Refresh token reutilizado; sessão encerrada (IP %s)", clientIP(r))
+			}
+			h.clearSessionCookies(w)
+			http.Error(w, "Sessão expirada, faça login novamente", http.StatusUnauthorized)
+			return
+		}
+		log.Printf("Erro ao renovar a sessão: %v", err)
+		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+		return
+	}
+
+	h.setSessionCookies(w, tokens)
+
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(tokens)
 }
 
 func (h *userHandler) GetMe(w http.ResponseWriter, r *http.Request) {
@@ -101,14 +155,494 @@ func (h *userHandler) GetMe(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(user)
 }
 
+// Logout revoga a sessão atual no servidor, além de apagar os cookies.
 func (h *userHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	var refreshToken string
+	if cookie, err := r.Cookie(refreshCookieName); err == nil {
+		refreshToken = cookie.Value
+	}
+	sessionID, _ := r.Context().Value(middleware.SessionIDKey).(int64)
+
+	if err := h.service.Logout(r.Context(), refreshToken, sessionID); err != nil {
+		log.Printf("Erro ao encerrar a sessão: %v", err)
+		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+		return
+	}
+
+	h.clearSessionCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LogoutAll encerra todas as sessões do usuário, inclusive a atual.
+func (h *userHandler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "ID do usuário inválido no contexto", http.StatusInternalServerError)
+		return
+	}
+
+	revoked, err := h.service.LogoutAll(r.Context(), userID)
+	if err != nil {
+		log.Printf("Erro ao encerrar as sessões: %v", err)
+		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+		return
+	}
+
+	h.clearSessionCookies(w)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]int64{"revoked_sessions": revoked})
+}
+
+// RequestPasswordReset responde 202 mesmo para e-mails sem conta.
+func (h *userHandler) RequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var req PasswordResetRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		http.Error(w, "Corpo da requisição inválido", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.RequestPasswordReset(r.Context(), req.Email); err != nil {
+		log.Printf("Erro ao pedir a redefinição de senha: %v", err)
+		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *userHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req PasswordResetConfirmRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Corpo da requisição inválido", http.StatusBadRequest)
+		return
+	}
+
+	err := h.service.ResetPassword(r.Context(), req.Token, req.Password)
+	if err != nil {
+		if errors.Is(err, ErrInvalidToken) || errors.Is(err, ErrWeakPassword) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Erro ao redefinir a senha: %v", err)
+		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+		return
+	}
+
+	h.clearSessionCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SendEmailVerification reenvia o link de confirmação para o usuário logado.
+func (h *userHandler) SendEmailVerification(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "ID do usuário inválido no contexto", http.StatusInternalServerError)
+		return
+	}
+
+	err := h.service.SendEmailVerification(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, ErrEmailAlreadyVerified) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		log.Printf("Erro ao enviar a confirmação de e-mail: %v", err)
+		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *userHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req EmailVerificationConfirmRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Corpo da requisição inválido", http.StatusBadRequest)
+		return
+	}
+
+	err := h.service.VerifyEmail(r.Context(), req.Token)
+	if err != nil {
+		if errors.Is(err, ErrInvalidToken) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Erro ao confirmar o e-mail: %v", err)
+		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *userHandler) UpdateMe(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "ID do usuário inválido no contexto", http.StatusInternalServerError)
+		return
+	}
+
+	var req UpdateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Corpo da requisição inválido", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.service.UpdateProfile(r.Context(), userID, req)
+	if err != nil {
+		if errors.Is(err, ErrInvalidName) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, ErrUserNotFound) {
+			http.Error(w, "Usuário não encontrado", http.StatusNotFound)
+			return
+		}
+		log.Printf("Erro ao atualizar o usuário: %v", err)
+		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(user)
+}
+
+// RequestEmailChange envia o link de confirmação para o novo e-mail.
+func (h *userHandler) RequestEmailChange(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "ID do usuário inválido no contexto", http.StatusInternalServerError)
+		return
+	}
+
+	var req ChangeEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Corpo da requisição inválido", http.StatusBadRequest)
+		return
+	}
+
+	err := h.service.RequestEmailChange(r.Context(), userID, req)
+	if err != nil {
+		h.writeAccountError(w, "Erro ao pedir a troca de e-mail", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *userHandler) ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	var req ChangeEmailConfirmRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Corpo da requisição inválido", http.StatusBadRequest)
+		return
+	}
+
+	err := h.service.ConfirmEmailChange(r.Context(), req.Token)
+	if err != nil {
+		h.writeAccountError(w, "Erro ao confirmar a troca de e-mail", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *userHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "ID do usuário inválido no contexto", http.StatusInternalServerError)
+		return
+	}
+	sessionID, _ := r.Context().Value(middleware.SessionIDKey).(int64)
+
+	var req ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Corpo da requisição inválido", http.StatusBadRequest)
+		return
+	}
+
+	err := h.service.ChangePassword(r.Context(), userID, sessionID, req)
+	if err != nil {
+		h.writeAccountError(w, "Erro ao trocar a senha", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteMe exclui a conta do usuário logado; a senha é pedida de novo.
+func (h *userHandler) DeleteMe(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "ID do usuário inválido no contexto", http.StatusInternalServerError)
+		return
+	}
+
+	var req DeleteAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Corpo da requisição inválido", http.StatusBadRequest)
+		return
+	}
+
+	err := h.service.DeleteAccount(r.Context(), userID, req.Password)
+	if err != nil {
+		h.writeAccountError(w, "Erro ao excluir a conta", err)
+		return
+	}
+
+	h.clearSessionCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ExportMe devolve todos os dados do usuário num arquivo JSON para download.
+func (h *userHandler) ExportMe(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		http.Error(w, "ID do usuário inválido no contexto", http.StatusInternalServerError)
+		return
+	}
+
+	export, err := h.service.Export(r.Context(), userID)
+	if err != nil {
+		h.writeAccountError(w, "Erro ao exportar os dados", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="meus-dados-%s.json"`, export.ExportedAt.Format("2006-01-02")))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(export)
+}
+
+func (h *userHandler) writeAccountError(w http.ResponseWriter, logMessage string, err error) {
+	switch {
+	case errors.Is(err, ErrWrongPassword):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, ErrInvalidEmail), errors.Is(err, ErrWeakPassword), errors.Is(err, ErrInvalidToken):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrEmailAlreadyInUse), errors.Is(err, ErrLastSuperAdmin), errors.Is(err, ErrLastStoreAdmin):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, ErrUserNotFound):
+		http.Error(w, "Usuário não encontrado", http.StatusNotFound)
+	default:
+		log.Printf("%s: %v", logMessage, err)
+		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+	}
+}
+
+// adminListOptions define a ordenação e os filtros de GET /admin/users
+var adminListOptions = pagination.Options{
+	Sorts: map[string]string{
+		"name":       "name",
+		"email":      "email",
+		"role":       "role",
+		"created_at": "created_at",
+	},
+	DefaultSort: "name",
+	Tiebreaker:  "id",
+	Filters: map[string]pagination.Filter{
+		"role":     {Column: "role", Kind: pagination.FilterText},
+		"store_id": {Column: "store_id", Kind: pagination.FilterInt},
+		"email":    {Column: "email", Kind: pagination.FilterContains},
+		"name":     {Column: "name", Kind: pagination.FilterContains},
+	},
+}
+
+func (h *userHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	params, err := pagination.Parse(r, adminListOptions)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	users, err := h.service.ListUsers(r.Context(), params)
+	if err != nil {
+		log.Printf("Erro ao listar usuários: %v", err)
+		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+		return
+	}
+
+	users.SetLinks(w, r)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(users)
+}
+
+func (h *userHandler) ChangeRole(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID do usuário inválido", http.StatusBadRequest)
+		return
+	}
+
+	var req ChangeRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Corpo da requisição inválido", http.StatusBadRequest)
+		return
+	}
+
+	newRole, err := role.Parse(req.Role)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.service.ChangeRole(r.Context(), RoleChange{
+		UserID:     userID,
+		ChangedBy:  actorID(r),
+		NewRole:    newRole,
+		NewStoreID: req.StoreID,
+		Source:     RoleChangeSourceAPI,
+	})
+	if err != nil {
+		writeRoleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(user)
+}
+
+func (h *userHandler) AttachStore(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID do usuário inválido", http.StatusBadRequest)
+		return
+	}
+
+	var req AttachStoreRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.StoreID <= 0 {
+		http.Error(w, "Corpo da requisição inválido", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.service.SetStore(r.Context(), actorID(r), userID, &req.StoreID)
+	if err != nil {
+		writeRoleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(user)
+}
+
+func (h *userHandler) DetachStore(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID do usuário inválido", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.service.SetStore(r.Context(), actorID(r), userID, nil)
+	if err != nil {
+		writeRoleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(user)
+}
+
+func (h *userHandler) GetRoleChanges(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID do usuário inválido", http.StatusBadRequest)
+		return
+	}
+
+	changes, err := h.service.GetRoleChanges(r.Context(), userID)
+	if err != nil {
+		writeRoleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(changes)
+}
+
+// actorID é quem está fazendo a mudança, para o histórico de cargos.
+func actorID(r *http.Request) *int64 {
+	id, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		return nil
+	}
+	return &id
+}
+
+func writeRoleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrUserNotFound):
+		http.Error(w, "Usuário não encontrado", http.StatusNotFound)
+	case errors.Is(err, ErrStoreNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, role.ErrInvalidRole), errors.Is(err, ErrStoreRequired):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrLastSuperAdmin), errors.Is(err, ErrLastStoreAdmin):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Printf("Erro ao alterar o cargo: %v", err)
+		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+	}
+}
+
+func (h *userHandler) setSessionCookies(w http.ResponseWriter, tokens Tokens) {
 	http.SetCookie(w, &http.Cookie{
-		Name:     "token",
+		Name:     accessCookieName,
+		Value:    tokens.AccessToken,
+		Expires:  tokens.AccessExpiresAt,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   h.secureCookies,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     refreshCookieName,
+		Value:    tokens.RefreshToken,
+		Expires:  tokens.RefreshExpiresAt,
+		Path:     refreshCookiePath,
+		HttpOnly: true,
+		Secure:   h.secureCookies,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+func (h *userHandler) clearSessionCookies(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     accessCookieName,
 		Value:    "",
 		Path:     "/",
 		MaxAge:   -1,
 		HttpOnly: true,
+		Secure:   h.secureCookies,
 	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     refreshCookieName,
+		Value:    "",
+		Path:     refreshCookiePath,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   h.secureCookies,
+	})
+}
 
-	w.WriteHeader(http.StatusNoContent)
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
 }
@@ -34,7 +34,7 @@ func (r *pgxRepository) Create(ctx context.Context, user User) (User, error) {
 }
 
 func (r *pgxRepository) GetByEmail(ctx context.Context, email string) (User, error) {
-	query := `SELECT id, name, email, password_hash, phone, created_at, role, store_id FROM users WHERE email = $1`
+	query := `SELECT id, name, email, password_hash, phone, created_at, role, store_id, email_verified_at FROM users WHERE email = $1`
 
 	var user User
 
@@ -47,6 +47,7 @@ func (r *pgxRepository) GetByEmail(ctx context.Context, email string) (User, err
 		&user.CreatedAt,
 		&user.Role,
 		&user.StoreID,
+		&user.EmailVerifiedAt,
 	)
 
 	if err != nil {
@@ -60,7 +61,7 @@ func (r *pgxRepository) GetByEmail(ctx context.Context, email string) (User, err
 }
 
 func (r *pgxRepository) GetByID(ctx context.Context, id int64) (User, error) {
-	query := `SELECT id, name, email, password_hash, phone, created_at, role, store_id FROM users WHERE id = $1`
+	query := `SELECT id, name, email, password_hash, phone, created_at, role, store_id, email_verified_at FROM users WHERE id = $1`
 
 	var user User
 
@@ -73,6 +74,7 @@ func (r *pgxRepository) GetByID(ctx context.Context, id int64) (User, error) {
 		&user.CreatedAt,
 		&user.Role,
 		&user.StoreID,
+		&user.EmailVerifiedAt,
 	)
 
 	if err != nil {
@@ -85,21 +87,6 @@ func (r *pgxRepository) GetByID(ctx context.Context, id int64) (User, error) {
 	return user, nil
 }
 
-func (r *pgxRepository) UpdateRole(ctx context.Context, email string, role string) error {
-	query := `UPDATE users SET role = $1 WHERE email = $2`
-
-	tag, err := r.db.Exec(ctx, query, role, email)
-	if err != nil {
-		return err
-	}
-
-	if tag.RowsAffected() == 0 {
-		return ErrUserNotFound
-	}
-
-	return nil
-}
-
 func (r *pgxRepository) CreateWithTx(ctx context.Context, tx pgx.Tx, user User) (User, error) {
 	query := `
 		INSERT INTO users (name, email, password_hash, phone, role, store_id)
@@ -0,0 +1,226 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"localiza-compra/backend/internal/api/pagination"
+	"localiza-compra/backend/internal/api/role"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	RoleChangeSourceAPI        = "api"
+	RoleChangeSourceCLI        = "cli"
+	RoleChangeSourceInvitation = "invitation"
+)
+
+var (
+	ErrStoreRequired  = errors.New("este cargo precisa de uma loja vinculada")
+	ErrStoreNotFound  = errors.New("loja não encontrada")
+	ErrLastSuperAdmin = errors.New("não é possível remover o último super administrador")
+	ErrLastStoreAdmin = errors.New("a loja precisa de pelo menos um administrador")
+)
+
+// RoleChange é uma mudança de cargo ou de loja. Na entrada, ChangedBy,
+// NewRole e NewStoreID descrevem o pedido; o resto é preenchido ao gravar.
+type RoleChange struct {
+	ID         int64     `json:"id"`
+	UserID     int64     `json:"user_id"`
+	ChangedBy  *int64    `json:"changed_by"`
+	OldRole    role.Role `json:"old_role"`
+	NewRole    role.Role `json:"new_role"`
+	OldStoreID *int64    `json:"old_store_id"`
+	NewStoreID *int64    `json:"new_store_id"`
+	Source     string    `json:"source"`
+	ChangedAt  time.Time `json:"changed_at"`
+}
+
+type ChangeRoleRequest struct {
+	Role    string `json:"role"`
+	StoreID *int64 `json:"store_id"`
+}
+
+type AttachStoreRequest struct {
+	StoreID int64 `json:"store_id"`
+}
+
+func isForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23503"
+}
+
+func (r *pgxRepository) List(ctx context.Context, params pagination.Params) ([]User, int, error) {
+	base := sq.Select().From("users").PlaceholderFormat(sq.Dollar)
+
+	total, err := pagination.Count(ctx, r.db, params.Filter(base.Columns("COUNT(*)")))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query, args, err := params.Apply(base.Columns("id", "name", "email", "phone", "created_at", "role", "store_id", "email_verified_at")).ToSql()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer rows.Close()
+
+	users := make([]User, 0)
+
+	for rows.Next() {
+		var u User
+
+		err := rows.Scan(&u.ID, &u.Name, &u.Email, &u.Phone, &u.CreatedAt, &u.Role, &u.StoreID, &u.EmailVerifiedAt)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		users = append(users, u)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return users, total, nil
+}
+
+// ChangeRole grava o novo cargo e a nova loja, registra a mudança no
+// histórico e encerra as sessões do usuário para o token antigo não continuar
+// valendo com o cargo anterior.
+func (r *pgxRepository) ChangeRole(ctx context.Context, change RoleChange) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err = r.ChangeRoleWithTx(ctx, tx, change); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ChangeRoleWithTx faz o mesmo que ChangeRole dentro de uma transação já aberta.
+func (r *pgxRepository) ChangeRoleWithTx(ctx context.Context, tx pgx.Tx, change RoleChange) error {
+	err := tx.QueryRow(ctx, `SELECT role, store_id FROM users WHERE id = $1 FOR UPDATE`, change.UserID).Scan(&change.OldRole, &change.OldStoreID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+
+	if err = guardLastAdmins(ctx, tx, change.OldRole, change.OldStoreID, change.NewRole, change.NewStoreID); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE users SET role = $1, store_id = $2 WHERE id = $3`, change.NewRole, change.NewStoreID, change.UserID)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return ErrStoreNotFound
+		}
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO user_role_changes (user_id, changed_by, old_role, new_role, old_store_id, new_store_id, source)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		change.UserID, change.ChangedBy, change.OldRole, change.NewRole, change.OldStoreID, change.NewStoreID, change.Source)
+	if err != nil {
+		return err
+	}
+
+	// Um cliente que ganha um cargo não perde nada: basta renovar o token
+	if change.OldRole == role.Customer {
+		return nil
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE user_sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`, change.UserID)
+	return err
+}
+
+// guardLastAdmins impede que a mudança (ou a exclusão, com newRole vazio)
+// deixe o sistema sem super admin ou a loja sem administrador. Os
+// administradores ficam travados até o fim da transação, para duas remoções
+// simultâneas não passarem as duas pela contagem.
+func guardLastAdmins(ctx context.Context, tx pgx.Tx, oldRole role.Role, oldStoreID *int64, newRole role.Role, newStoreID *int64) error {
+	if oldRole == role.SuperAdmin && newRole != role.SuperAdmin {
+		admins, err := countLocked(ctx, tx, `SELECT id FROM users WHERE role = $1 FOR UPDATE`, role.SuperAdmin)
+		if err != nil {
+			return err
+		}
+		if admins <= 1 {
+			return ErrLastSuperAdmin
+		}
+	}
+
+	leavesStore := newRole != role.StoreAdmin || newStoreID == nil || oldStoreID == nil || *newStoreID != *oldStoreID
+	if oldRole == role.StoreAdmin && oldStoreID != nil && leavesStore {
+		admins, err := countLocked(ctx, tx, `SELECT id FROM users WHERE role = $1 AND store_id = $2 FOR UPDATE`, role.StoreAdmin, *oldStoreID)
+		if err != nil {
+			return err
+		}
+		if admins <= 1 {
+			return ErrLastStoreAdmin
+		}
+	}
+
+	return nil
+}
+
+func countLocked(ctx context.Context, tx pgx.Tx, query string, args ...any) (int, error) {
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		count++
+	}
+	return count, rows.Err()
+}
+
+func (r *pgxRepository) GetRoleChanges(ctx context.Context, userID int64) ([]RoleChange, error) {
+	query := `SELECT id, user_id, changed_by, old_role, new_role, old_store_id, new_store_id, source, changed_at
+			FROM user_role_changes
+			WHERE user_id = $1
+			ORDER BY changed_at DESC, id DESC`
+
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	changes := make([]RoleChange, 0)
+
+	for rows.Next() {
+		var c RoleChange
+
+		err := rows.Scan(&c.ID, &c.UserID, &c.ChangedBy, &c.OldRole, &c.NewRole, &c.OldStoreID, &c.NewStoreID, &c.Source, &c.ChangedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		changes = append(changes, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
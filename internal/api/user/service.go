@@ -3,6 +3,15 @@ package user
 import (
 	"context"
 	"errors"
+	"fmt"
+	"localiza-compra/backend/internal/api/pagination"
+	"localiza-compra/backend/internal/api/role"
+	"localiza-compra/backend/internal/api/securetoken"
+	"localiza-compra/backend/internal/mailer"
+	"log"
+	"net/mail"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt"
@@ -10,26 +19,33 @@ import (
 )
 
 type userService struct {
-	repo Repository
+	repo   Repository
+	tokens TokenConfig
+	mailer mailer.Mailer
+	// appURL é o endereço do front-end, usado nos links enviados por e-mail
+	appURL string
 }
 
-func NewService(r Repository) Service {
+func NewService(r Repository, tokens TokenConfig, m mailer.Mailer, appURL string) Service {
 	return &userService{
-		repo: r,
+		repo:   r,
+		tokens: tokens,
+		mailer: m,
+		appURL: strings.TrimRight(appURL, "/"),
 	}
 }
 
 func (s *userService) Create(ctx context.Context, user User) (User, error) {
 	if user.Name == "" {
-		return User{}, errors.New("o nome de usuário não pode ser vazio")
+		return User{}, ErrInvalidName
 	}
 	if len(user.PasswordHash) < 8 {
-		return User{}, errors.New("a senha precisa ter mais de 8 digitos")
+		return User{}, ErrWeakPassword
 	}
 
 	_, err := s.repo.GetByEmail(ctx, user.Email)
 	if err == nil {
-		return User{}, errors.New("o email já está em uso")
+		return User{}, ErrEmailAlreadyInUse
 	}
 
 	if !errors.Is(err, ErrUserNotFound) {
@@ -43,38 +59,448 @@ func (s *userService) Create(ctx context.Context, user User) (User, error) {
 
 	user.PasswordHash = string(hashedPassword)
 
-	return s.repo.Create(ctx, user)
-}
+	created, err := s.repo.Create(ctx, user)
+	if err != nil {
+		return User{}, err
+	}
+
+	// A conta já existe; se o e-mail falhar o usuário pode pedir outro link
+	if err := s.sendVerification(ctx, created); err != nil {
+		log.Printf("Erro ao enviar a confirmação de e-mail para o usuário %d: %v", created.ID, err)
+	}
 
-var jwtSecret = []byte("sua-chave-super-secreta")
+	return created, nil
+}
 
-func (s *userService) Login(ctx context.Context, email, password string) (string, error) {
+func (s *userService) Login(ctx context.Context, email, password string, meta SessionMeta) (Tokens, error) {
 	user, err := s.repo.GetByEmail(ctx, email)
 	if err != nil {
-		return "", errors.New("credenciais inválidas")
+		if errors.Is(err, ErrUserNotFound) {
+			return Tokens{}, ErrInvalidCredentials
+		}
+		return Tokens{}, err
 	}
 
 	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
 	if err != nil {
-		return "", errors.New("credenciais inválidas")
+		return Tokens{}, ErrInvalidCredentials
+	}
+
+	refreshToken, refreshHash, err := securetoken.NewRandom()
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	session, err := s.repo.CreateSession(ctx, Session{
+		UserID:           user.ID,
+		RefreshTokenHash: refreshHash,
+		UserAgent:        meta.UserAgent,
+		IP:               meta.IP,
+		ExpiresAt:        time.Now().Add(s.tokens.RefreshTTL),
+	})
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	return s.issueTokens(user, session, refreshToken)
+}
+
+// Refresh troca um refresh token válido por um novo par de tokens. O cargo e a
+// loja são relidos do banco, então mudanças valem a partir da próxima renovação.
+func (s *userService) Refresh(ctx context.Context, refreshToken string) (Tokens, error) {
+	if refreshToken == "" {
+		return Tokens{}, ErrInvalidRefreshToken
+	}
+
+	newToken, newHash, err := securetoken.NewRandom()
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	session, err := s.repo.RotateSession(ctx, securetoken.Hash(refreshToken), newHash)
+	if err != nil {
+		return Tokens{}, err
 	}
 
+	user, err := s.repo.GetByID(ctx, session.UserID)
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	return s.issueTokens(user, session, newToken)
+}
+
+// issueTokens assina o token de acesso, que carrega o ID da sessão em "sid"
+// para o middleware conseguir recusar sessões revogadas.
+func (s *userService) issueTokens(user User, session Session, refreshToken string) (Tokens, error) {
+	accessExpiresAt := time.Now().Add(s.tokens.AccessTTL)
+
 	claims := jwt.MapClaims{
 		"sub":  user.ID,
+		"sid":  session.ID,
 		"role": user.Role,
-		"exp":  time.Now().Add(time.Hour * 24).Unix(),
+		"exp":  accessExpiresAt.Unix(),
+	}
+	if user.StoreID != nil {
+		claims["store_id"] = *user.StoreID
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
-	tokenString, err := token.SignedString(jwtSecret)
+	tokenString, err := token.SignedString(s.tokens.Secret)
 	if err != nil {
-		return "", err
+		return Tokens{}, err
+	}
+
+	return Tokens{
+		AccessToken:      tokenString,
+		AccessExpiresAt:  accessExpiresAt,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: session.ExpiresAt,
+	}, nil
+}
+
+// Logout encerra a sessão atual, encontrada pelo refresh token ou, na falta
+// dele, pelo ID da sessão do token de acesso.
+func (s *userService) Logout(ctx context.Context, refreshToken string, sessionID int64) error {
+	if refreshToken != "" {
+		if err := s.repo.RevokeSessionByRefreshHash(ctx, securetoken.Hash(refreshToken)); err != nil {
+			return err
+		}
+	}
+	if sessionID != 0 {
+		return s.repo.RevokeSession(ctx, sessionID)
 	}
+	return nil
+}
 
-	return tokenString, nil
+func (s *userService) LogoutAll(ctx context.Context, userID int64) (int64, error) {
+	return s.repo.RevokeAllSessions(ctx, userID)
+}
+
+func (s *userService) IsSessionActive(ctx context.Context, sessionID int64) (bool, error) {
+	return s.repo.IsSessionActive(ctx, sessionID)
 }
 
 func (s *userService) GetByID(ctx context.Context, id int64) (User, error) {
 	return s.repo.GetByID(ctx, id)
 }
+
+// RequestPasswordReset envia o link de redefinição. Um e-mail desconhecido não
+// gera erro, para a rota não revelar quem tem conta.
+func (s *userService) RequestPasswordReset(ctx context.Context, email string) error {
+	user, err := s.repo.GetByEmail(ctx, strings.TrimSpace(email))
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	token, err := s.createToken(ctx, user.ID, TokenPurposePasswordReset, passwordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	err = s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Redefinição de senha",
+		Body: fmt.Sprintf("Olá, %s!\n\nRecebemos um pedido para redefinir a sua senha. Use o link abaixo em até %d minutos:\n\n%s/redefinir-senha?token=%s\n\nSe não foi você, ignore este e-mail; a senha atual continua valendo.\n",
+			user.Name, int(passwordResetTTL.Minutes()), s.appURL, url.QueryEscape(token)),
+	})
+	if err != nil {
+		// Uma falha só para contas existentes também revelaria quem tem conta
+		log.Printf("Erro ao enviar a redefinição de senha do usuário %d: %v", user.ID, err)
+	}
+	return nil
+}
+
+// ResetPassword troca a senha e encerra todas as sessões abertas.
+func (s *userService) ResetPassword(ctx context.Context, token, password string) error {
+	hash, err := securetoken.VerifySigned(s.tokens.Secret, TokenPurposePasswordReset, token)
+	if err != nil {
+		return err
+	}
+
+	if len(password) < 8 {
+		return ErrWeakPassword
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.repo.ResetPassword(ctx, hash, string(hashedPassword))
+	return err
+}
+
+func (s *userService) SendEmailVerification(ctx context.Context, userID int64) error {
+	user, err := s.repo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if user.EmailVerifiedAt != nil {
+		return ErrEmailAlreadyVerified
+	}
+
+	return s.sendVerification(ctx, user)
+}
+
+func (s *userService) VerifyEmail(ctx context.Context, token string) error {
+	hash, err := securetoken.VerifySigned(s.tokens.Secret, TokenPurposeEmailVerification, token)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.repo.VerifyEmail(ctx, hash)
+	return err
+}
+
+func (s *userService) sendVerification(ctx context.Context, user User) error {
+	token, err := s.createToken(ctx, user.ID, TokenPurposeEmailVerification, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Confirme o seu e-mail",
+		Body: fmt.Sprintf("Olá, %s!\n\nConfirme o seu e-mail pelo link abaixo (válido por %d horas):\n\n%s/verificar-email?token=%s\n",
+			user.Name, int(emailVerificationTTL.Hours()), s.appURL, url.QueryEscape(token)),
+	})
+}
+
+func (s *userService) UpdateProfile(ctx context.Context, id int64, req UpdateUserRequest) (User, error) {
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			return User{}, ErrInvalidName
+		}
+		req.Name = &name
+	}
+	if req.Phone != nil {
+		phone := strings.TrimSpace(*req.Phone)
+		req.Phone = &phone
+	}
+
+	if req.Name != nil || req.Phone != nil {
+		if err := s.repo.PartialUpdate(ctx, id, req); err != nil {
+			return User{}, err
+		}
+	}
+
+	return s.repo.GetByID(ctx, id)
+}
+
+// RequestEmailChange confere a senha e manda o link de confirmação para o
+// novo endereço. O e-mail antigo continua valendo até o link ser usado.
+func (s *userService) RequestEmailChange(ctx context.Context, id int64, req ChangeEmailRequest) error {
+	user, err := s.checkPassword(ctx, id, req.Password)
+	if err != nil {
+		return err
+	}
+
+	address, err := mail.ParseAddress(strings.TrimSpace(req.Email))
+	if err != nil || address.Name != "" {
+		return ErrInvalidEmail
+	}
+	email := address.Address
+	if strings.EqualFold(email, user.Email) {
+		return ErrEmailAlreadyInUse
+	}
+
+	_, err = s.repo.GetByEmail(ctx, email)
+	if err == nil {
+		return ErrEmailAlreadyInUse
+	}
+	if !errors.Is(err, ErrUserNotFound) {
+		return err
+	}
+
+	token, hash, err := securetoken.NewSigned(s.tokens.Secret, TokenPurposeEmailChange)
+	if err != nil {
+		return err
+	}
+
+	err = s.repo.CreateToken(ctx, UserToken{
+		UserID:    user.ID,
+		Purpose:   TokenPurposeEmailChange,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(emailChangeTTL),
+		Payload:   &email,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = s.mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Confirme o seu novo e-mail",
+		Body: fmt.Sprintf("Olá, %s!\n\nPara usar este endereço na sua conta, confirme pelo link abaixo (válido por %d horas):\n\n%s/confirmar-email?token=%s\n",
+			user.Name, int(emailChangeTTL.Hours()), s.appURL, url.QueryEscape(token)),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Aviso no endereço antigo, caso a troca não tenha sido pedida pelo dono
+	err = s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Pedido de troca de e-mail",
+		Body:    fmt.Sprintf("Olá, %s!\n\nRecebemos um pedido para trocar o e-mail da sua conta para %s. Se não foi você, troque a sua senha.\n", user.Name, email),
+	})
+	if err != nil {
+		log.Printf("Erro ao avisar o e-mail antigo do usuário %d: %v", user.ID, err)
+	}
+
+	return nil
+}
+
+func (s *userService) ConfirmEmailChange(ctx context.Context, token string) error {
+	hash, err := securetoken.VerifySigned(s.tokens.Secret, TokenPurposeEmailChange, token)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.repo.ChangeEmail(ctx, hash)
+	return err
+}
+
+// ChangePassword exige a senha atual e encerra as outras sessões.
+func (s *userService) ChangePassword(ctx context.Context, id, sessionID int64, req ChangePasswordRequest) error {
+	if _, err := s.checkPassword(ctx, id, req.CurrentPassword); err != nil {
+		return err
+	}
+
+	if len(req.NewPassword) < 8 {
+		return ErrWeakPassword
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.UpdatePassword(ctx, id, string(hashedPassword), sessionID)
+}
+
+// DeleteAccount exclui a conta e, em cascata, as sessões e as listas de
+// compras. O último super admin e o último administrador de uma loja precisam
+// passar o cargo antes.
+func (s *userService) DeleteAccount(ctx context.Context, id int64, password string) error {
+	if _, err := s.checkPassword(ctx, id, password); err != nil {
+		return err
+	}
+
+	return s.repo.Delete(ctx, id)
+}
+
+func (s *userService) Export(ctx context.Context, id int64) (DataExport, error) {
+	return s.repo.Export(ctx, id)
+}
+
+func (s *userService) checkPassword(ctx context.Context, id int64, password string) (User, error) {
+	user, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return User{}, err
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return User{}, ErrWrongPassword
+	}
+
+	return user, nil
+}
+
+func (s *userService) ListUsers(ctx context.Context, params pagination.Params) (pagination.Page[User], error) {
+	users, total, err := s.repo.List(ctx, params)
+	if err != nil {
+		return pagination.Page[User]{}, err
+	}
+	return pagination.NewPage(users, total, params), nil
+}
+
+// ChangeRole troca o cargo. Sem NewStoreID a loja atual é mantida; clientes
+// perdem o vínculo com a loja.
+func (s *userService) ChangeRole(ctx context.Context, change RoleChange) (User, error) {
+	if !change.NewRole.Valid() {
+		return User{}, role.ErrInvalidRole
+	}
+
+	user, err := s.repo.GetByID(ctx, change.UserID)
+	if err != nil {
+		return User{}, err
+	}
+
+	if change.NewStoreID == nil {
+		change.NewStoreID = user.StoreID
+	}
+	if change.NewRole == role.Customer {
+		change.NewStoreID = nil
+	}
+
+	return s.applyRoleChange(ctx, user, change)
+}
+
+// SetStore vincula o usuário a uma loja (ou desvincula, com storeID nulo)
+// sem mudar o cargo.
+func (s *userService) SetStore(ctx context.Context, changedBy *int64, userID int64, storeID *int64) (User, error) {
+	user, err := s.repo.GetByID(ctx, userID)
+	if err != nil {
+		return User{}, err
+	}
+
+	return s.applyRoleChange(ctx, user, RoleChange{
+		UserID:     userID,
+		ChangedBy:  changedBy,
+		NewRole:    user.Role,
+		NewStoreID: storeID,
+		Source:     RoleChangeSourceAPI,
+	})
+}
+
+func (s *userService) applyRoleChange(ctx context.Context, user User, change RoleChange) (User, error) {
+	if change.NewRole.RequiresStore() && change.NewStoreID == nil {
+		return User{}, ErrStoreRequired
+	}
+
+	sameStore := (user.StoreID == nil && change.NewStoreID == nil) ||
+		(user.StoreID != nil && change.NewStoreID != nil && *user.StoreID == *change.NewStoreID)
+	if user.Role == change.NewRole && sameStore {
+		return user, nil
+	}
+
+	if err := s.repo.ChangeRole(ctx, change); err != nil {
+		return User{}, err
+	}
+
+	return s.repo.GetByID(ctx, change.UserID)
+}
+
+func (s *userService) GetRoleChanges(ctx context.Context, userID int64) ([]RoleChange, error) {
+	if _, err := s.repo.GetByID(ctx, userID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetRoleChanges(ctx, userID)
+}
+
+func (s *userService) createToken(ctx context.Context, userID int64, purpose string, ttl time.Duration) (string, error) {
+	token, hash, err := securetoken.NewSigned(s.tokens.Secret, purpose)
+	if err != nil {
+		return "", err
+	}
+
+	err = s.repo.CreateToken(ctx, UserToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
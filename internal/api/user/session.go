@@ -0,0 +1,155 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrInvalidCredentials  = errors.New("credenciais inválidas")
+	ErrInvalidRefreshToken = errors.New("refresh token inválido ou expirado")
+	// ErrRefreshTokenReused indica que um refresh token já trocado foi usado de
+	// novo; a sessão é encerrada porque o token provavelmente vazou.
+	ErrRefreshTokenReused = errors.New("refresh token reutilizado")
+)
+
+// TokenConfig define como os tokens de acesso e de renovação são emitidos.
+type TokenConfig struct {
+	Secret     []byte
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+}
+
+type Session struct {
+	ID               int64
+	UserID           int64
+	RefreshTokenHash string
+	UserAgent        string
+	IP               string
+	CreatedAt        time.Time
+	ExpiresAt        time.Time
+}
+
+// SessionMeta identifica de onde veio o login, para o usuário reconhecer as sessões.
+type SessionMeta struct {
+	UserAgent string
+	IP        string
+}
+
+// Tokens é o par emitido no login e a cada renovação.
+type Tokens struct {
+	AccessToken      string    `json:"-"`
+	AccessExpiresAt  time.Time `json:"access_expires_at"`
+	RefreshToken     string    `json:"-"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+func (r *pgxRepository) CreateSession(ctx context.Context, s Session) (Session, error) {
+	query := `
+		INSERT INTO user_sessions (user_id, refresh_token_hash, user_agent, ip, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`
+
+	err := r.db.QueryRow(ctx, query, s.UserID, s.RefreshTokenHash, s.UserAgent, s.IP, s.ExpiresAt).Scan(&s.ID, &s.CreatedAt)
+	if err != nil {
+		return Session{}, err
+	}
+
+	return s, nil
+}
+
+// RotateSession troca o refresh token da sessão. Se o hash apresentado for o
+// anterior, a sessão é revogada e ErrRefreshTokenReused é devolvido.
+func (r *pgxRepository) RotateSession(ctx context.Context, oldHash, newHash string) (Session, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return Session{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		SELECT id, user_id, user_agent, ip, created_at, expires_at,
+			revoked_at IS NOT NULL, refresh_token_hash = $1
+		FROM user_sessions
+		WHERE refresh_token_hash = $1 OR previous_token_hash = $1
+		FOR UPDATE`
+
+	var s Session
+	var revoked, current bool
+	err = tx.QueryRow(ctx, query, oldHash).Scan(&s.ID, &s.UserID, &s.UserAgent, &s.IP, &s.CreatedAt, &s.ExpiresAt, &revoked, &current)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Session{}, ErrInvalidRefreshToken
+		}
+		return Session{}, err
+	}
+
+	if revoked || time.Now().After(s.ExpiresAt) {
+		return Session{}, ErrInvalidRefreshToken
+	}
+
+	if !current {
+		_, err = tx.Exec(ctx, `UPDATE user_sessions SET revoked_at = NOW() WHERE id = $1`, s.ID)
+		if err != nil {
+			return Session{}, err
+		}
+		if err = tx.Commit(ctx); err != nil {
+			return Session{}, err
+		}
+		return Session{}, ErrRefreshTokenReused
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE user_sessions
+		SET refresh_token_hash = $2, previous_token_hash = $3, last_used_at = NOW()
+		WHERE id = $1`, s.ID, newHash, oldHash)
+	if err != nil {
+		return Session{}, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return Session{}, err
+	}
+
+	s.RefreshTokenHash = newHash
+	return s, nil
+}
+
+func (r *pgxRepository) RevokeSessionByRefreshHash(ctx context.Context, hash string) error {
+	query := `UPDATE user_sessions SET revoked_at = NOW() WHERE refresh_token_hash = $1 AND revoked_at IS NULL`
+
+	_, err := r.db.Exec(ctx, query, hash)
+	return err
+}
+
+func (r *pgxRepository) RevokeSession(ctx context.Context, sessionID int64) error {
+	query := `UPDATE user_sessions SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL`
+
+	_, err := r.db.Exec(ctx, query, sessionID)
+	return err
+}
+
+func (r *pgxRepository) RevokeAllSessions(ctx context.Context, userID int64) (int64, error) {
+	query := `UPDATE user_sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+
+	tag, err := r.db.Exec(ctx, query, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+func (r *pgxRepository) IsSessionActive(ctx context.Context, sessionID int64) (bool, error) {
+	query := `SELECT EXISTS (
+				SELECT 1 FROM user_sessions
+				WHERE id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+			)`
+
+	var active bool
+	err := r.db.QueryRow(ctx, query, sessionID).Scan(&active)
+	return active, err
+}
@@ -0,0 +1,150 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"localiza-compra/backend/internal/api/securetoken"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	TokenPurposePasswordReset     = "password_reset"
+	TokenPurposeEmailVerification = "email_verification"
+	TokenPurposeEmailChange       = "email_change"
+
+	passwordResetTTL     = time.Hour
+	emailVerificationTTL = 48 * time.Hour
+	emailChangeTTL       = 24 * time.Hour
+)
+
+var (
+	ErrInvalidToken         = securetoken.ErrInvalid
+	ErrEmailAlreadyVerified = errors.New("o e-mail já foi confirmado")
+)
+
+// UserToken é um token de uso único já gravado (só o hash).
+type UserToken struct {
+	UserID    int64
+	Purpose   string
+	TokenHash string
+	ExpiresAt time.Time
+	// Payload leva dados do pedido, como o novo e-mail na troca de e-mail
+	Payload *string
+}
+
+type PasswordResetRequest struct {
+	Email string `json:"email"`
+}
+
+type PasswordResetConfirmRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type EmailVerificationConfirmRequest struct {
+	Token string `json:"token"`
+}
+
+// CreateToken grava um novo token e invalida os anteriores da mesma
+// finalidade, para só o último link enviado funcionar.
+func (r *pgxRepository) CreateToken(ctx context.Context, t UserToken) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		UPDATE user_tokens SET used_at = NOW()
+		WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`, t.UserID, t.Purpose)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO user_tokens (user_id, purpose, token_hash, expires_at, payload)
+		VALUES ($1, $2, $3, $4, $5)`, t.UserID, t.Purpose, t.TokenHash, t.ExpiresAt, t.Payload)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// consumeToken marca o token como usado e devolve o dono e o payload. O
+// UPDATE com used_at IS NULL garante que dois usos simultâneos não passam os dois.
+func consumeToken(ctx context.Context, tx pgx.Tx, purpose, hash string) (int64, string, error) {
+	query := `
+		UPDATE user_tokens SET used_at = NOW()
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id, COALESCE(payload, '')`
+
+	var userID int64
+	var payload string
+	err := tx.QueryRow(ctx, query, hash, purpose).Scan(&userID, &payload)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, "", ErrInvalidToken
+		}
+		return 0, "", err
+	}
+
+	return userID, payload, nil
+}
+
+// ResetPassword troca a senha com um token de redefinição e encerra todas as
+// sessões do usuário, tudo na mesma transação.
+func (r *pgxRepository) ResetPassword(ctx context.Context, tokenHash, passwordHash string) (int64, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	userID, _, err := consumeToken(ctx, tx, TokenPurposePasswordReset, tokenHash)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE users SET password_hash = $1 WHERE id = $2`, passwordHash, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE user_sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+func (r *pgxRepository) VerifyEmail(ctx context.Context, tokenHash string) (int64, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	userID, _, err := consumeToken(ctx, tx, TokenPurposeEmailVerification, tokenHash)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE users SET email_verified_at = NOW() WHERE id = $1 AND email_verified_at IS NULL`, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
@@ -3,12 +3,19 @@ package user
 import (
 	"context"
 	"errors"
+	"localiza-compra/backend/internal/api/pagination"
+	"localiza-compra/backend/internal/api/role"
 	"time"
 
 	"github.com/jackc/pgx/v5"
 )
 
-var ErrUserNotFound = errors.New("usuario não encontrado")
+var (
+	ErrUserNotFound = errors.New("usuario não encontrado")
+	ErrWeakPassword = errors.New("a senha precisa ter mais de 8 digitos")
+	ErrInvalidEmail = errors.New("e-mail inválido")
+	ErrInvalidName  = errors.New("o nome de usuário não pode ser vazio")
+)
 
 type User struct {
 	ID           int64     `json:"id"`
@@ -17,8 +24,10 @@ type User struct {
 	PasswordHash string    `json:"-"`
 	Phone        string    `json:"phone,omitempty"`
 	CreatedAt    time.Time `json:"created_at"`
-	Role         string    `json:"-"`
+	Role         role.Role `json:"role"`
 	StoreID      *int64    `json:"store_id"`
+	// Nulo enquanto o usuário não confirmou o e-mail
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
 }
 
 type CreateUserRequest struct {
@@ -33,25 +42,54 @@ type LoginUserRequest struct {
 	Password string `json:"password"`
 }
 
-type UpdateUserRole struct {
-	Email *string `json:"email"`
-	Role  *string `json:"role"`
-}
-
 type Repository interface {
 	GetByID(ctx context.Context, id int64) (User, error)
 	GetByEmail(ctx context.Context, email string) (User, error)
 	Create(ctx context.Context, user User) (User, error)
 	CreateWithTx(ctx context.Context, tx pgx.Tx, user User) (User, error)
-	// Update(ctx context.Context, user User) (User, error)
-	// Delete(ctx context.Context, id int64) error
-	UpdateRole(ctx context.Context, email string, role string) error
+	PartialUpdate(ctx context.Context, id int64, req UpdateUserRequest) error
+	UpdatePassword(ctx context.Context, id int64, passwordHash string, keepSessionID int64) error
+	ChangeEmail(ctx context.Context, tokenHash string) (int64, error)
+	Delete(ctx context.Context, id int64) error
+	Export(ctx context.Context, id int64) (DataExport, error)
+	List(ctx context.Context, params pagination.Params) ([]User, int, error)
+	ChangeRole(ctx context.Context, change RoleChange) error
+	ChangeRoleWithTx(ctx context.Context, tx pgx.Tx, change RoleChange) error
+	GetRoleChanges(ctx context.Context, userID int64) ([]RoleChange, error)
+
+	CreateSession(ctx context.Context, s Session) (Session, error)
+	RotateSession(ctx context.Context, oldHash, newHash string) (Session, error)
+	RevokeSession(ctx context.Context, sessionID int64) error
+	RevokeSessionByRefreshHash(ctx context.Context, hash string) error
+	RevokeAllSessions(ctx context.Context, userID int64) (int64, error)
+	IsSessionActive(ctx context.Context, sessionID int64) (bool, error)
+
+	CreateToken(ctx context.Context, t UserToken) error
+	ResetPassword(ctx context.Context, tokenHash, passwordHash string) (int64, error)
+	VerifyEmail(ctx context.Context, tokenHash string) (int64, error)
 }
 
 type Service interface {
 	GetByID(ctx context.Context, id int64) (User, error)
 	Create(ctx context.Context, user User) (User, error)
-	// Update(ctx context.Context, user User) (User, error)
-	// Delete(ctx context.Context, id int64) error
-	Login(ctx context.Context, email, password string) (string, error)
+	UpdateProfile(ctx context.Context, id int64, req UpdateUserRequest) (User, error)
+	RequestEmailChange(ctx context.Context, id int64, req ChangeEmailRequest) error
+	ConfirmEmailChange(ctx context.Context, token string) error
+	ChangePassword(ctx context.Context, id, sessionID int64, req ChangePasswordRequest) error
+	DeleteAccount(ctx context.Context, id int64, password string) error
+	Export(ctx context.Context, id int64) (DataExport, error)
+	ListUsers(ctx context.Context, params pagination.Params) (pagination.Page[User], error)
+	ChangeRole(ctx context.Context, change RoleChange) (User, error)
+	SetStore(ctx context.Context, changedBy *int64, userID int64, storeID *int64) (User, error)
+	GetRoleChanges(ctx context.Context, userID int64) ([]RoleChange, error)
+	Login(ctx context.Context, email, password string, meta SessionMeta) (Tokens, error)
+	Refresh(ctx context.Context, refreshToken string) (Tokens, error)
+	Logout(ctx context.Context, refreshToken string, sessionID int64) error
+	LogoutAll(ctx context.Context, userID int64) (int64, error)
+	IsSessionActive(ctx context.Context, sessionID int64) (bool, error)
+
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, password string) error
+	SendEmailVerification(ctx context.Context, userID int64) error
+	VerifyEmail(ctx context.Context, token string) error
 }
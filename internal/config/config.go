@@ -0,0 +1,340 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"localiza-compra/backend/internal/database"
+	"localiza-compra/backend/internal/geocoder"
+	"localiza-compra/backend/internal/mailer"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	EnvDevelopment = "development"
+	EnvProduction  = "production"
+
+	// Segredo usado só em desenvolvimento; em produção o JWT_SECRET é obrigatório
+	devJWTSecret       = "sua-chave-super-secreta"
+	minProdSecretBytes = 32
+)
+
+// Config reúne tudo o que o servidor e a CLI leem do ambiente.
+type Config struct {
+	Env         string
+	Port        int
+	CORSOrigins []string
+	JWTSecret   []byte
+	AutoMigrate bool
+
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+
+	// AppURL é o endereço do front-end, usado nos links enviados por e-mail
+	AppURL string
+
+	// Mailer escolhe o envio de e-mails: "smtp", "file" (grava em MailDir) ou "log"
+	Mailer       string
+	MailDir      string
+	MailFrom     string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+
+	// GeocoderTable é um arquivo prefixo,latitude,longitude para resolver CEPs;
+	// vazio usa a tabela embutida com as capitais
+	GeocoderTable string
+
+	DatabaseURL       string
+	DBMaxConns        int32
+	DBMinConns        int32
+	DBMaxConnLifetime time.Duration
+	DBMaxConnIdleTime time.Duration
+
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+
+	// ShutdownDrainDelay é quanto esperar, já respondendo 503 na prontidão,
+	// antes de parar de aceitar conexões; dá tempo ao balanceador de tirar a instância.
+	ShutdownDrainDelay time.Duration
+	ShutdownTimeout    time.Duration
+}
+
+func (c Config) IsProduction() bool {
+	return c.Env == EnvProduction
+}
+
+// Addr é o endereço em que o servidor HTTP escuta.
+func (c Config) Addr() string {
+	return fmt.Sprintf(":%d", c.Port)
+}
+
+// Pool são os limites do pool de conexões para database.Connect.
+func (c Config) Pool() database.PoolConfig {
+	return database.PoolConfig{
+		MaxConns:        c.DBMaxConns,
+		MinConns:        c.DBMinConns,
+		MaxConnLifetime: c.DBMaxConnLifetime,
+		MaxConnIdleTime: c.DBMaxConnIdleTime,
+	}
+}
+
+// NewMailer cria o Mailer escolhido em MAILER.
+func (c Config) NewMailer() (mailer.Mailer, error) {
+	switch c.Mailer {
+	case "smtp":
+		return mailer.NewSMTPMailer(mailer.SMTPConfig{
+			Host:     c.SMTPHost,
+			Port:     c.SMTPPort,
+			Username: c.SMTPUsername,
+			Password: c.SMTPPassword,
+			From:     c.MailFrom,
+		})
+	case "file":
+		return mailer.NewFileMailer(c.MailDir)
+	default:
+		return mailer.NewLogMailer(), nil
+	}
+}
+
+// NewGeocoder cria o Geocoder da busca por CEP, a partir de GEOCODER_TABLE ou
+// da tabela embutida.
+func (c Config) NewGeocoder() (geocoder.Geocoder, error) {
+	if c.GeocoderTable == "" {
+		return geocoder.NewDefaultTableGeocoder(), nil
+	}
+	return geocoder.LoadTableGeocoder(c.GeocoderTable)
+}
+
+// Load lê a configuração das variáveis de ambiente. Se CONFIG_FILE apontar
+// para um arquivo no formato CHAVE=valor, ele é lido antes e as variáveis de
+// ambiente têm prioridade sobre ele.
+func Load() (Config, error) {
+	values := make(map[string]string)
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		fileValues, err := readFile(path)
+		if err != nil {
+			return Config{}, err
+		}
+		values = fileValues
+	}
+
+	get := func(key, fallback string) string {
+		if v, ok := os.LookupEnv(key); ok && v != "" {
+			return v
+		}
+		if v, ok := values[key]; ok && v != "" {
+			return v
+		}
+		return fallback
+	}
+
+	var errs []error
+
+	cfg := Config{
+		Env:          strings.ToLower(get("APP_ENV", EnvDevelopment)),
+		JWTSecret:    []byte(get("JWT_SECRET", "")),
+		DatabaseURL:  get("DATABASE_URL", ""),
+		AppURL:       get("APP_URL", "http://localhost:3005"),
+		Mailer:       strings.ToLower(get("MAILER", "log")),
+		MailDir:      get("MAIL_DIR", "tmp/mail"),
+		MailFrom:     get("MAIL_FROM", "Localiza Compra <nao-responda@localizacompra.com.br>"),
+		SMTPHost:     get("SMTP_HOST", ""),
+		SMTPUsername: get("SMTP_USERNAME", ""),
+		SMTPPassword: get("SMTP_PASSWORD", ""),
+
+		GeocoderTable: get("GEOCODER_TABLE", ""),
+	}
+
+	for _, origin := range strings.Split(get("CORS_ORIGINS", "http://localhost:3005"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			cfg.CORSOrigins = append(cfg.CORSOrigins, origin)
+		}
+	}
+
+	parseInt := func(key, fallback string) int {
+		v, err := strconv.Atoi(get(key, fallback))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s precisa ser um número inteiro", key))
+		}
+		return v
+	}
+	parseDuration := func(key, fallback string) time.Duration {
+		v, err := time.ParseDuration(get(key, fallback))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s precisa ser uma duração, ex.: 30s ou 5m", key))
+		}
+		return v
+	}
+	parseBool := func(key, fallback string) bool {
+		v, err := strconv.ParseBool(get(key, fallback))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s precisa ser true ou false", key))
+		}
+		return v
+	}
+
+	cfg.Port = parseInt("PORT", "8080")
+	cfg.SMTPPort = parseInt("SMTP_PORT", "587")
+	cfg.AutoMigrate = parseBool("AUTO_MIGRATE", "false")
+
+	cfg.AccessTokenTTL = parseDuration("ACCESS_TOKEN_TTL", "15m")
+	cfg.RefreshTokenTTL = parseDuration("REFRESH_TOKEN_TTL", "720h")
+
+	cfg.DBMaxConns = int32(parseInt("DB_MAX_CONNS", "10"))
+	cfg.DBMinConns = int32(parseInt("DB_MIN_CONNS", "0"))
+	cfg.DBMaxConnLifetime = parseDuration("DB_MAX_CONN_LIFETIME", "1h")
+	cfg.DBMaxConnIdleTime = parseDuration("DB_MAX_CONN_IDLE_TIME", "30m")
+
+	cfg.ReadHeaderTimeout = parseDuration("SERVER_READ_HEADER_TIMEOUT", "5s")
+	cfg.ReadTimeout = parseDuration("SERVER_READ_TIMEOUT", "15s")
+	cfg.WriteTimeout = parseDuration("SERVER_WRITE_TIMEOUT", "30s")
+	cfg.IdleTimeout = parseDuration("SERVER_IDLE_TIMEOUT", "120s")
+
+	cfg.ShutdownDrainDelay = parseDuration("SHUTDOWN_DRAIN_DELAY", "0s")
+	cfg.ShutdownTimeout = parseDuration("SHUTDOWN_TIMEOUT", "30s")
+
+	if len(errs) > 0 {
+		return Config{}, errors.Join(errs...)
+	}
+
+	if len(cfg.JWTSecret) == 0 && !cfg.IsProduction() {
+		cfg.JWTSecret = []byte(devJWTSecret)
+	}
+
+	return cfg, nil
+}
+
+// ValidateDatabase confere só o necessário para falar com o banco (CLI).
+func (c Config) ValidateDatabase() error {
+	var errs []error
+
+	if c.DatabaseURL == "" {
+		errs = append(errs, errors.New("DATABASE_URL não foi definida"))
+	}
+	if c.DBMaxConns < 1 {
+		errs = append(errs, errors.New("DB_MAX_CONNS precisa ser maior que zero"))
+	}
+	if c.DBMinConns < 0 || c.DBMinConns > c.DBMaxConns {
+		errs = append(errs, errors.New("DB_MIN_CONNS precisa estar entre 0 e DB_MAX_CONNS"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Validate confere a configuração completa do servidor. Em produção, segredos
+// ausentes ou fracos impedem a subida.
+func (c Config) Validate() error {
+	errs := []error{c.ValidateDatabase()}
+
+	if c.Env != EnvDevelopment && c.Env != EnvProduction {
+		errs = append(errs, fmt.Errorf("APP_ENV precisa ser %q ou %q", EnvDevelopment, EnvProduction))
+	}
+	if c.Port < 1 || c.Port > 65535 {
+		errs = append(errs, errors.New("PORT precisa estar entre 1 e 65535"))
+	}
+	if len(c.CORSOrigins) == 0 {
+		errs = append(errs, errors.New("CORS_ORIGINS precisa ter pelo menos uma origem"))
+	}
+
+	if c.IsProduction() {
+		switch {
+		case len(c.JWTSecret) == 0:
+			errs = append(errs, errors.New("JWT_SECRET é obrigatório em produção"))
+		case string(c.JWTSecret) == devJWTSecret:
+			errs = append(errs, errors.New("JWT_SECRET não pode ser o segredo de desenvolvimento em produção"))
+		case len(c.JWTSecret) < minProdSecretBytes:
+			errs = append(errs, fmt.Errorf("JWT_SECRET precisa ter pelo menos %d caracteres em produção", minProdSecretBytes))
+		}
+		for _, origin := range c.CORSOrigins {
+			if origin == "*" {
+				errs = append(errs, errors.New("CORS_ORIGINS não pode ser * em produção, pois os cookies são enviados"))
+			}
+		}
+	}
+
+	for key, d := range map[string]time.Duration{
+		"SERVER_READ_HEADER_TIMEOUT": c.ReadHeaderTimeout,
+		"SERVER_READ_TIMEOUT":        c.ReadTimeout,
+		"SERVER_WRITE_TIMEOUT":       c.WriteTimeout,
+		"SERVER_IDLE_TIMEOUT":        c.IdleTimeout,
+	} {
+		if d <= 0 {
+			errs = append(errs, fmt.Errorf("%s precisa ser maior que zero", key))
+		}
+	}
+
+	switch c.Mailer {
+	case "log", "file":
+		if c.IsProduction() {
+			errs = append(errs, fmt.Errorf("MAILER=%s não envia e-mails de verdade; use smtp em produção", c.Mailer))
+		}
+	case "smtp":
+		if c.SMTPHost == "" {
+			errs = append(errs, errors.New("SMTP_HOST é obrigatório com MAILER=smtp"))
+		}
+		if c.IsProduction() && c.SMTPUsername != "" && c.SMTPPassword == "" {
+			errs = append(errs, errors.New("SMTP_PASSWORD é obrigatório em produção quando SMTP_USERNAME está definido"))
+		}
+	default:
+		errs = append(errs, errors.New("MAILER precisa ser smtp, file ou log"))
+	}
+	if c.AppURL == "" {
+		errs = append(errs, errors.New("APP_URL não foi definida"))
+	}
+
+	if c.AccessTokenTTL <= 0 || c.RefreshTokenTTL <= 0 {
+		errs = append(errs, errors.New("ACCESS_TOKEN_TTL e REFRESH_TOKEN_TTL precisam ser maiores que zero"))
+	} else if c.AccessTokenTTL >= c.RefreshTokenTTL {
+		errs = append(errs, errors.New("ACCESS_TOKEN_TTL precisa ser menor que REFRESH_TOKEN_TTL"))
+	}
+	if c.ShutdownDrainDelay < 0 {
+		errs = append(errs, errors.New("SHUTDOWN_DRAIN_DELAY não pode ser negativo"))
+	}
+	if c.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("SHUTDOWN_TIMEOUT precisa ser maior que zero"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// readFile lê um arquivo CHAVE=valor, ignorando linhas vazias e comentários (#).
+func readFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("não foi possível abrir o arquivo de configuração: %w", err)
+	}
+	defer file.Close()
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(text, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: linha sem '='", path, line)
+		}
+		value = strings.TrimSpace(value)
+		value = strings.Trim(value, `"'`)
+		values[strings.TrimSpace(key)] = value
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
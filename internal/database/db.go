@@ -2,29 +2,49 @@ package database
 
 import (
 	"context"
+	"fmt"
 	"log"
-	"os"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func Connect() *pgxpool.Pool {
-	// Pega a URL do banco de dados a partir das variáveis de ambiente que definimos no docker
-	databaseUrl := os.Getenv("DATABASE_URL")
-	if databaseUrl == "" {
-		log.Fatal("DATABASE_URL não foi definida.")
+// PoolConfig são os limites do pool de conexões com o banco.
+type PoolConfig struct {
+	MaxConns        int32
+	MinConns        int32
+	MaxConnLifetime time.Duration
+	MaxConnIdleTime time.Duration
+}
+
+func Connect(databaseUrl string, pool PoolConfig) (*pgxpool.Pool, error) {
+	cfg, err := pgxpool.ParseConfig(databaseUrl)
+	if err != nil {
+		return nil, fmt.Errorf("DATABASE_URL inválida: %w", err)
+	}
+
+	if pool.MaxConns > 0 {
+		cfg.MaxConns = pool.MaxConns
+	}
+	cfg.MinConns = pool.MinConns
+	if pool.MaxConnLifetime > 0 {
+		cfg.MaxConnLifetime = pool.MaxConnLifetime
+	}
+	if pool.MaxConnIdleTime > 0 {
+		cfg.MaxConnIdleTime = pool.MaxConnIdleTime
 	}
 
-	dbpool, err := pgxpool.New(context.Background(), databaseUrl)
+	dbpool, err := pgxpool.NewWithConfig(context.Background(), cfg)
 	if err != nil {
-		log.Fatalf("Não foi possível conectar ao banco de dados: %v\n", err)
+		return nil, fmt.Errorf("não foi possível conectar ao banco de dados: %w", err)
 	}
 
 	err = dbpool.Ping(context.Background())
 	if err != nil {
-		log.Fatalf("Ping para o banco de dados falhou: %v\n", err)
+		dbpool.Close()
+		return nil, fmt.Errorf("ping para o banco de dados falhou: %w", err)
 	}
 
 	log.Println("Conexão com o banco de dados estabelecida com sucesso.")
-	return dbpool
+	return dbpool, nil
 }
@@ -0,0 +1,157 @@
+package database
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/pgx/v5"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+// As migrações vão dentro do binário, então qualquer ambiente consegue montar
+// o banco do zero sem precisar do repositório.
+//
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// Migration é uma migração embutida e se ela já foi aplicada no banco.
+type Migration struct {
+	Version uint
+	Name    string
+	Applied bool
+}
+
+// MigrationStatus é a versão atual do banco e a lista de migrações conhecidas.
+// Dirty indica que a última migração falhou no meio e precisa de intervenção.
+type MigrationStatus struct {
+	Version    uint
+	Dirty      bool
+	Migrations []Migration
+}
+
+func newMigrate(databaseUrl string) (*migrate.Migrate, error) {
+	source, err := iofs.New(migrationsFS, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := migrate.NewWithSourceInstance("iofs", source, pgxMigrateURL(databaseUrl))
+	if err != nil {
+		return nil, fmt.Errorf("não foi possível preparar as migrações: %w", err)
+	}
+
+	return m, nil
+}
+
+// pgxMigrateURL troca o esquema postgres:// pelo pgx5:// que o driver do migrate espera.
+func pgxMigrateURL(databaseUrl string) string {
+	for _, scheme := range []string{"postgres://", "postgresql://"} {
+		if strings.HasPrefix(databaseUrl, scheme) {
+			return "pgx5://" + strings.TrimPrefix(databaseUrl, scheme)
+		}
+	}
+	return databaseUrl
+}
+
+func closeMigrate(m *migrate.Migrate, err error) error {
+	sourceErr, dbErr := m.Close()
+	return errors.Join(err, sourceErr, dbErr)
+}
+
+// MigrateUp aplica todas as migrações pendentes.
+func MigrateUp(databaseUrl string) (err error) {
+	m, err := newMigrate(databaseUrl)
+	if err != nil {
+		return err
+	}
+	defer func() { err = closeMigrate(m, err) }()
+
+	if err = m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return err
+	}
+
+	return nil
+}
+
+// MigrateDown desfaz as últimas steps migrações.
+func MigrateDown(databaseUrl string, steps int) (err error) {
+	if steps < 1 {
+		return errors.New("o número de migrações a desfazer precisa ser maior que zero")
+	}
+
+	m, err := newMigrate(databaseUrl)
+	if err != nil {
+		return err
+	}
+	defer func() { err = closeMigrate(m, err) }()
+
+	if err = m.Steps(-steps); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return err
+	}
+
+	return nil
+}
+
+// GetMigrationStatus compara as migrações embutidas com a versão do banco.
+func GetMigrationStatus(databaseUrl string) (status MigrationStatus, err error) {
+	m, err := newMigrate(databaseUrl)
+	if err != nil {
+		return MigrationStatus{}, err
+	}
+	defer func() { err = closeMigrate(m, err) }()
+
+	version, dirty, err := m.Version()
+	if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
+		return MigrationStatus{}, err
+	}
+
+	migrations, err := embeddedMigrations()
+	if err != nil {
+		return MigrationStatus{}, err
+	}
+
+	for i := range migrations {
+		migrations[i].Applied = migrations[i].Version <= version
+		// Uma migração suja ainda não terminou de ser aplicada
+		if dirty && migrations[i].Version == version {
+			migrations[i].Applied = false
+		}
+	}
+
+	return MigrationStatus{Version: version, Dirty: dirty, Migrations: migrations}, nil
+}
+
+// embeddedMigrations lista as migrações a partir dos arquivos .up.sql.
+func embeddedMigrations() ([]Migration, error) {
+	files, err := fs.Glob(migrationsFS, "migrations/*.up.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]Migration, 0, len(files))
+	for _, file := range files {
+		name := strings.TrimSuffix(strings.TrimPrefix(file, "migrations/"), ".up.sql")
+
+		prefix, rest, ok := strings.Cut(name, "_")
+		if !ok {
+			return nil, fmt.Errorf("nome de migração inválido: %s", file)
+		}
+
+		version, err := strconv.ParseUint(prefix, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("nome de migração inválido: %s", file)
+		}
+
+		migrations = append(migrations, Migration{Version: uint(version), Name: rest})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
@@ -1,2 +1,2 @@
-DROP TABLE shopping_lists;
 DROP TABLE shopping_list_items;
+DROP TABLE shopping_lists;
@@ -1 +1 @@
-ALTER TABLE stock_items DROP COLUMN role;
+ALTER TABLE users DROP COLUMN role;
@@ -0,0 +1 @@
+ALTER TABLE stock_items DROP CONSTRAINT stock_items_store_product_key;
@@ -0,0 +1,9 @@
+-- Remove duplicatas criadas antes da restrição, mantendo o registro mais recente
+DELETE FROM stock_items a
+USING stock_items b
+WHERE a.store_id = b.store_id
+  AND a.product_id = b.product_id
+  AND a.id < b.id;
+
+ALTER TABLE stock_items
+ADD CONSTRAINT stock_items_store_product_key UNIQUE (store_id, product_id);
@@ -0,0 +1,15 @@
+CREATE TABLE stock_price_history (
+    id BIGSERIAL PRIMARY KEY,
+    store_id BIGINT NOT NULL,
+    product_id BIGINT NOT NULL,
+    price NUMERIC(10, 2) NOT NULL,
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (store_id) REFERENCES stores(id) ON DELETE CASCADE,
+    FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_stock_price_history_product_store ON stock_price_history (product_id, store_id, changed_at);
+
+-- O preço atual de cada item vira o primeiro ponto do histórico
+INSERT INTO stock_price_history (store_id, product_id, price)
+SELECT store_id, product_id, price FROM stock_items;
@@ -0,0 +1,2 @@
+ALTER TABLE products ADD COLUMN barcode TEXT NULL;
+ALTER TABLE products ADD CONSTRAINT products_barcode_key UNIQUE (barcode);
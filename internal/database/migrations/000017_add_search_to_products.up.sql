@@ -0,0 +1,17 @@
+CREATE EXTENSION IF NOT EXISTS unaccent;
+
+-- Português com remoção de acentos: "açúcar" e "acucar" viram o mesmo lexema
+CREATE TEXT SEARCH CONFIGURATION portuguese_unaccent (COPY = portuguese);
+ALTER TEXT SEARCH CONFIGURATION portuguese_unaccent
+    ALTER MAPPING FOR hword, hword_part, word
+    WITH unaccent, portuguese_stem;
+
+-- Nome pesa mais que marca, que pesa mais que descrição
+ALTER TABLE products ADD COLUMN search_vector tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('portuguese_unaccent', coalesce(name, '')), 'A') ||
+        setweight(to_tsvector('portuguese_unaccent', coalesce(brand, '')), 'B') ||
+        setweight(to_tsvector('portuguese_unaccent', coalesce(description, '')), 'C')
+    ) STORED;
+
+CREATE INDEX idx_products_search_vector ON products USING GIN (search_vector);
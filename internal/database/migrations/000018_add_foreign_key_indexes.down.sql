@@ -0,0 +1,7 @@
+DROP INDEX idx_users_store_id;
+DROP INDEX idx_categories_parent_id;
+DROP INDEX idx_products_category_id;
+DROP INDEX idx_shopping_list_items_product_id;
+DROP INDEX idx_shopping_list_items_list_id;
+DROP INDEX idx_shopping_lists_user_id;
+DROP INDEX idx_stock_items_product_id;
@@ -0,0 +1,9 @@
+-- Índices para as colunas usadas nos JOINs e filtros dos repositórios.
+-- stock_items (store_id, product_id) já é coberto pela restrição única.
+CREATE INDEX idx_stock_items_product_id ON stock_items (product_id);
+CREATE INDEX idx_shopping_lists_user_id ON shopping_lists (user_id);
+CREATE INDEX idx_shopping_list_items_list_id ON shopping_list_items (shopping_list_id);
+CREATE INDEX idx_shopping_list_items_product_id ON shopping_list_items (product_id);
+CREATE INDEX idx_products_category_id ON products (category_id);
+CREATE INDEX idx_categories_parent_id ON categories (parent_id);
+CREATE INDEX idx_users_store_id ON users (store_id);
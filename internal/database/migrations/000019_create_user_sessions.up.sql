@@ -0,0 +1,20 @@
+-- Cada login abre uma sessão. O refresh token é guardado só como hash e
+-- troca a cada uso; previous_token_hash permite detectar o reuso de um token
+-- já trocado (sinal de roubo) e encerrar a sessão.
+CREATE TABLE user_sessions (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    refresh_token_hash TEXT NOT NULL,
+    previous_token_hash TEXT,
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT user_sessions_refresh_token_hash_key UNIQUE (refresh_token_hash)
+);
+
+CREATE INDEX idx_user_sessions_user_id ON user_sessions (user_id);
+CREATE INDEX idx_user_sessions_previous_token_hash ON user_sessions (previous_token_hash);
@@ -0,0 +1,17 @@
+ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMPTZ;
+
+-- Tokens de uso único para redefinir a senha e confirmar o e-mail. Só o hash
+-- é guardado; used_at marca o uso e impede que o mesmo link valha duas vezes.
+CREATE TABLE user_tokens (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    purpose TEXT NOT NULL,
+    token_hash TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT user_tokens_token_hash_key UNIQUE (token_hash)
+);
+
+CREATE INDEX idx_user_tokens_user_purpose ON user_tokens (user_id, purpose);
@@ -0,0 +1,9 @@
+ALTER TABLE shopping_list_items DROP CONSTRAINT shopping_list_items_shopping_list_id_fkey;
+ALTER TABLE shopping_list_items
+    ADD CONSTRAINT shopping_list_items_shopping_list_id_fkey FOREIGN KEY (shopping_list_id) REFERENCES shopping_lists(id);
+
+ALTER TABLE shopping_lists DROP CONSTRAINT shopping_lists_user_id_fkey;
+ALTER TABLE shopping_lists
+    ADD CONSTRAINT shopping_lists_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id);
+
+ALTER TABLE user_tokens DROP COLUMN payload;
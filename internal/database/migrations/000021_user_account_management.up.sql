@@ -0,0 +1,11 @@
+-- payload guarda dados do pedido, como o novo e-mail numa troca de e-mail
+ALTER TABLE user_tokens ADD COLUMN payload TEXT;
+
+-- Ao excluir a conta, as listas de compras do usuário vão junto
+ALTER TABLE shopping_lists DROP CONSTRAINT shopping_lists_user_id_fkey;
+ALTER TABLE shopping_lists
+    ADD CONSTRAINT shopping_lists_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+ALTER TABLE shopping_list_items DROP CONSTRAINT shopping_list_items_shopping_list_id_fkey;
+ALTER TABLE shopping_list_items
+    ADD CONSTRAINT shopping_list_items_shopping_list_id_fkey FOREIGN KEY (shopping_list_id) REFERENCES shopping_lists(id) ON DELETE CASCADE;
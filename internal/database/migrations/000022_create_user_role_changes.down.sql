@@ -0,0 +1,2 @@
+DROP INDEX idx_users_role;
+DROP TABLE user_role_changes;
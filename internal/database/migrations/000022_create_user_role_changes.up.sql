@@ -0,0 +1,18 @@
+-- Histórico de mudanças de cargo e de loja. changed_by fica nulo quando a
+-- mudança veio da CLI.
+CREATE TABLE user_role_changes (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    changed_by BIGINT,
+    old_role TEXT NOT NULL,
+    new_role TEXT NOT NULL,
+    old_store_id BIGINT,
+    new_store_id BIGINT,
+    source TEXT NOT NULL,
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (changed_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_user_role_changes_user_id ON user_role_changes (user_id, changed_at);
+CREATE INDEX idx_users_role ON users (role);
@@ -0,0 +1,21 @@
+-- Convites para a equipe da loja. O token vai por e-mail e só o hash fica
+-- gravado; o convite vale uma vez, para o e-mail convidado.
+CREATE TABLE store_invitations (
+    id BIGSERIAL PRIMARY KEY,
+    store_id BIGINT NOT NULL,
+    email TEXT NOT NULL,
+    role TEXT NOT NULL,
+    token_hash TEXT NOT NULL,
+    invited_by BIGINT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    accepted_at TIMESTAMPTZ,
+    accepted_by BIGINT,
+    revoked_at TIMESTAMPTZ,
+    FOREIGN KEY (store_id) REFERENCES stores(id) ON DELETE CASCADE,
+    FOREIGN KEY (invited_by) REFERENCES users(id) ON DELETE SET NULL,
+    FOREIGN KEY (accepted_by) REFERENCES users(id) ON DELETE SET NULL,
+    CONSTRAINT store_invitations_token_hash_key UNIQUE (token_hash)
+);
+
+CREATE INDEX idx_store_invitations_store_id ON store_invitations (store_id);
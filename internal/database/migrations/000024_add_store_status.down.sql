@@ -0,0 +1,7 @@
+DROP INDEX idx_stores_status;
+
+ALTER TABLE stores DROP COLUMN reviewed_by;
+ALTER TABLE stores DROP COLUMN reviewed_at;
+ALTER TABLE stores DROP COLUMN status_reason;
+ALTER TABLE stores DROP CONSTRAINT stores_status_check;
+ALTER TABLE stores DROP COLUMN status;
@@ -0,0 +1,12 @@
+-- Lojas novas entram como pendentes e só aparecem para os clientes depois de
+-- aprovadas. As lojas que já existiam continuam no ar.
+ALTER TABLE stores ADD COLUMN status TEXT NOT NULL DEFAULT 'approved';
+ALTER TABLE stores ALTER COLUMN status SET DEFAULT 'pending';
+ALTER TABLE stores ADD CONSTRAINT stores_status_check
+    CHECK (status IN ('pending', 'approved', 'rejected', 'suspended'));
+
+ALTER TABLE stores ADD COLUMN status_reason TEXT;
+ALTER TABLE stores ADD COLUMN reviewed_at TIMESTAMPTZ;
+ALTER TABLE stores ADD COLUMN reviewed_by BIGINT REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_stores_status ON stores (status);
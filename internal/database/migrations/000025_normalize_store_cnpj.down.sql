@@ -0,0 +1 @@
+ALTER TABLE stores DROP CONSTRAINT stores_cnpj_format;
@@ -0,0 +1,38 @@
+-- Antes de mexer nos dados, confere se o CNPJ sem máscara de cada loja antiga
+-- fica no formato novo e não colide com o de outra loja no índice único. O
+-- CNPJ não pode ser alterado pela API e o Postgres confere o CHECK a cada
+-- UPDATE da linha, então um valor fora do formato travaria aprovação,
+-- suspensão e edição da loja. A migração para e lista as lojas para serem
+-- corrigidas à mão.
+DO $$
+DECLARE
+    problems text;
+BEGIN
+    SELECT string_agg(problem, '; ')
+    INTO problems
+    FROM (
+        SELECT format('CNPJ %s repetido nas lojas %s', normalized, string_agg(id::text, ', ' ORDER BY id)) AS problem
+        FROM (
+            SELECT id, upper(regexp_replace(cnpj, '[./[:space:]-]', '', 'g')) AS normalized
+            FROM stores
+        ) s
+        GROUP BY normalized
+        HAVING COUNT(*) > 1
+
+        UNION ALL
+
+        SELECT format('CNPJ %L fora do formato na loja %s', cnpj, id)
+        FROM stores
+        WHERE upper(regexp_replace(cnpj, '[./[:space:]-]', '', 'g')) !~ '^[0-9A-Z]{12}[0-9]{2}$'
+    ) p;
+
+    IF problems IS NOT NULL THEN
+        RAISE EXCEPTION 'corrija os CNPJs antes de migrar: %', problems;
+    END IF;
+END $$;
+
+-- Guarda o CNPJ sem máscara e com letras maiúsculas, como o cadastro passa a fazer
+UPDATE stores SET cnpj = upper(regexp_replace(cnpj, '[./[:space:]-]', '', 'g'));
+
+ALTER TABLE stores
+    ADD CONSTRAINT stores_cnpj_format CHECK (cnpj ~ '^[0-9A-Z]{12}[0-9]{2}$');
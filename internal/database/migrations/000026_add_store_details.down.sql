@@ -0,0 +1,14 @@
+DROP TABLE store_hour_exceptions;
+DROP TABLE store_opening_hours;
+
+ALTER TABLE stores DROP CONSTRAINT stores_coordinates_check;
+ALTER TABLE stores DROP CONSTRAINT stores_state_check;
+ALTER TABLE stores DROP CONSTRAINT stores_cep_check;
+
+ALTER TABLE stores DROP COLUMN timezone;
+ALTER TABLE stores DROP COLUMN longitude;
+ALTER TABLE stores DROP COLUMN latitude;
+ALTER TABLE stores DROP COLUMN phone;
+ALTER TABLE stores DROP COLUMN state;
+ALTER TABLE stores DROP COLUMN city;
+ALTER TABLE stores DROP COLUMN cep;
@@ -0,0 +1,40 @@
+ALTER TABLE stores ADD COLUMN cep TEXT;
+ALTER TABLE stores ADD COLUMN city TEXT;
+ALTER TABLE stores ADD COLUMN state TEXT;
+ALTER TABLE stores ADD COLUMN phone TEXT;
+ALTER TABLE stores ADD COLUMN latitude DOUBLE PRECISION;
+ALTER TABLE stores ADD COLUMN longitude DOUBLE PRECISION;
+ALTER TABLE stores ADD COLUMN timezone TEXT NOT NULL DEFAULT 'America/Sao_Paulo';
+
+ALTER TABLE stores ADD CONSTRAINT stores_cep_check CHECK (cep ~ '^[0-9]{8}$');
+ALTER TABLE stores ADD CONSTRAINT stores_state_check CHECK (state ~ '^[A-Z]{2}$');
+ALTER TABLE stores ADD CONSTRAINT stores_coordinates_check CHECK (
+    (latitude IS NULL AND longitude IS NULL)
+    OR (latitude BETWEEN -90 AND 90 AND longitude BETWEEN -180 AND 180)
+);
+
+-- Horário semanal. Um dia pode ter mais de um intervalo (ex.: fechado no almoço)
+-- e closes_at menor que opens_at indica que a loja fecha depois da meia-noite.
+CREATE TABLE store_opening_hours (
+    id BIGSERIAL PRIMARY KEY,
+    store_id BIGINT NOT NULL REFERENCES stores(id) ON DELETE CASCADE,
+    weekday SMALLINT NOT NULL CHECK (weekday BETWEEN 0 AND 6),
+    opens_at TIME NOT NULL,
+    closes_at TIME NOT NULL,
+    CHECK (opens_at <> closes_at)
+);
+
+CREATE INDEX idx_store_opening_hours_store ON store_opening_hours (store_id, weekday);
+
+-- Feriados e datas especiais: substituem o horário semanal no dia
+CREATE TABLE store_hour_exceptions (
+    id BIGSERIAL PRIMARY KEY,
+    store_id BIGINT NOT NULL REFERENCES stores(id) ON DELETE CASCADE,
+    date DATE NOT NULL,
+    closed BOOLEAN NOT NULL DEFAULT FALSE,
+    opens_at TIME,
+    closes_at TIME,
+    note TEXT NOT NULL DEFAULT '',
+    UNIQUE (store_id, date),
+    CHECK (closed OR (opens_at IS NOT NULL AND closes_at IS NOT NULL AND opens_at <> closes_at))
+);
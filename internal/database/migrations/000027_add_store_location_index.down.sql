@@ -0,0 +1 @@
+DROP INDEX idx_stores_location;
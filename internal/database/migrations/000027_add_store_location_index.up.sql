@@ -0,0 +1,2 @@
+-- Busca por proximidade: a caixa em volta do ponto filtra por este índice
+CREATE INDEX idx_stores_location ON stores (latitude, longitude) WHERE status = 'approved';
@@ -0,0 +1,2 @@
+ALTER TABLE shopping_list_items DROP CONSTRAINT shopping_list_items_quantity_check;
+ALTER TABLE shopping_list_items DROP CONSTRAINT shopping_list_items_list_product_key;
@@ -0,0 +1,34 @@
+-- Itens antigos com quantidade zero ou negativa passam a valer 1, para a
+-- soma abaixo e a restrição de quantidade valerem para todas as linhas
+UPDATE shopping_list_items SET quantity = 1 WHERE quantity <= 0;
+
+-- Junta as linhas repetidas do mesmo produto numa lista antes de criar o
+-- índice único: a primeira linha fica com a soma das quantidades e só continua
+-- marcada se todas estavam marcadas.
+WITH merged AS (
+    SELECT
+        MIN(id) AS keep_id,
+        shopping_list_id,
+        product_id,
+        SUM(quantity) AS quantity,
+        BOOL_AND(is_checked) AS is_checked
+    FROM shopping_list_items
+    GROUP BY shopping_list_id, product_id
+    HAVING COUNT(*) > 1
+), updated AS (
+    UPDATE shopping_list_items sli
+    SET quantity = m.quantity, is_checked = m.is_checked
+    FROM merged m
+    WHERE sli.id = m.keep_id
+)
+DELETE FROM shopping_list_items sli
+USING merged m
+WHERE sli.shopping_list_id = m.shopping_list_id
+    AND sli.product_id = m.product_id
+    AND sli.id <> m.keep_id;
+
+ALTER TABLE shopping_list_items
+    ADD CONSTRAINT shopping_list_items_list_product_key UNIQUE (shopping_list_id, product_id);
+
+ALTER TABLE shopping_list_items
+    ADD CONSTRAINT shopping_list_items_quantity_check CHECK (quantity > 0);
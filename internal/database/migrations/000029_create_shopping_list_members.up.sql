@@ -0,0 +1,12 @@
+-- Colaboradores de uma lista. O dono continua em shopping_lists.user_id e
+-- nunca aparece aqui.
+CREATE TABLE shopping_list_members (
+    list_id BIGINT NOT NULL REFERENCES shopping_lists(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role TEXT NOT NULL CHECK (role IN ('editor', 'viewer')),
+    added_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    added_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (list_id, user_id)
+);
+
+CREATE INDEX idx_shopping_list_members_user ON shopping_list_members (user_id);
@@ -0,0 +1,8 @@
+-- Itens sem produto não cabem no esquema antigo
+DELETE FROM shopping_list_items WHERE product_id IS NULL;
+
+ALTER TABLE shopping_list_items
+    DROP CONSTRAINT shopping_list_items_product_or_name_check,
+    DROP COLUMN note,
+    DROP COLUMN name,
+    ALTER COLUMN product_id SET NOT NULL;
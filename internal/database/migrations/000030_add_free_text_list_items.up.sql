@@ -0,0 +1,11 @@
+-- Itens escritos à mão ("pão francês") ficam sem produto até serem vinculados
+-- a um do catálogo. A chave única (lista, produto) continua valendo para os
+-- vinculados; NULLs não conflitam entre si.
+ALTER TABLE shopping_list_items
+    ALTER COLUMN product_id DROP NOT NULL,
+    ADD COLUMN name VARCHAR(255),
+    ADD COLUMN note TEXT;
+
+ALTER TABLE shopping_list_items
+    ADD CONSTRAINT shopping_list_items_product_or_name_check
+    CHECK (product_id IS NOT NULL OR btrim(name) <> '');
@@ -0,0 +1 @@
+DROP TABLE shopping_list_invitations;
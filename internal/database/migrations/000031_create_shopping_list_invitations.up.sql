@@ -0,0 +1,14 @@
+-- Convites para listas de compras. O compartilhamento por e-mail sempre vira
+-- um convite, exista ou não uma conta com o e-mail, para a resposta não
+-- revelar quem está cadastrado. O convidado aceita depois de entrar.
+CREATE TABLE shopping_list_invitations (
+    id BIGSERIAL PRIMARY KEY,
+    list_id BIGINT NOT NULL REFERENCES shopping_lists(id) ON DELETE CASCADE,
+    email TEXT NOT NULL,
+    role TEXT NOT NULL CHECK (role IN ('editor', 'viewer')),
+    invited_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX shopping_list_invitations_list_email_key ON shopping_list_invitations (list_id, lower(email));
+CREATE INDEX idx_shopping_list_invitations_email ON shopping_list_invitations (lower(email));
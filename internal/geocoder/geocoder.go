@@ -0,0 +1,39 @@
+package geocoder
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+var (
+	ErrInvalidCEP = errors.New("o CEP precisa ter 8 dígitos")
+	ErrNotFound   = errors.New("CEP não encontrado")
+)
+
+// Point é uma coordenada em graus decimais.
+type Point struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// Geocoder transforma um CEP em coordenadas. A busca de lojas depende só desta
+// interface, então dá para trocar a tabela local por um serviço externo.
+type Geocoder interface {
+	LookupCEP(ctx context.Context, cep string) (Point, error)
+}
+
+// NormalizeCEP tira a máscara e confere se sobraram 8 dígitos.
+func NormalizeCEP(cep string) (string, error) {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, cep)
+
+	if len(digits) != 8 {
+		return "", ErrInvalidCEP
+	}
+	return digits, nil
+}
@@ -0,0 +1,103 @@
+package geocoder
+
+import (
+	"bufio"
+	"context"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// A tabela embutida tem o centro aproximado das capitais pelos prefixos de
+// CEP de cada uma. Serve para desenvolvimento e como reserva; para precisão
+// de bairro, use GEOCODER_TABLE com uma tabela mais completa.
+//
+//go:embed ceps.csv
+var defaultTable string
+
+// TableGeocoder resolve o CEP pelo prefixo mais longo que aparece na tabela,
+// sem acessar a rede.
+type TableGeocoder struct {
+	points map[string]Point
+}
+
+// NewTableGeocoder lê uma tabela no formato "prefixo,latitude,longitude", uma
+// entrada por linha. Linhas vazias e começando com # são ignoradas.
+func NewTableGeocoder(r io.Reader) (*TableGeocoder, error) {
+	g := &TableGeocoder{points: make(map[string]Point)}
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Split(text, ",")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("tabela de CEPs, linha %d: esperado prefixo,latitude,longitude", line)
+		}
+
+		prefix := strings.TrimSpace(fields[0])
+		if prefix == "" || len(prefix) > 8 || strings.Trim(prefix, "0123456789") != "" {
+			return nil, fmt.Errorf("tabela de CEPs, linha %d: prefixo inválido %q", line, prefix)
+		}
+
+		lat, err := strconv.ParseFloat(strings.TrimSpace(fields[1]), 64)
+		if err != nil || lat < -90 || lat > 90 {
+			return nil, fmt.Errorf("tabela de CEPs, linha %d: latitude inválida", line)
+		}
+		lng, err := strconv.ParseFloat(strings.TrimSpace(fields[2]), 64)
+		if err != nil || lng < -180 || lng > 180 {
+			return nil, fmt.Errorf("tabela de CEPs, linha %d: longitude inválida", line)
+		}
+
+		g.points[prefix] = Point{Latitude: lat, Longitude: lng}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return g, nil
+}
+
+// NewDefaultTableGeocoder usa a tabela embutida no binário.
+func NewDefaultTableGeocoder() *TableGeocoder {
+	g, err := NewTableGeocoder(strings.NewReader(defaultTable))
+	if err != nil {
+		panic(err)
+	}
+	return g
+}
+
+// LoadTableGeocoder lê a tabela de um arquivo.
+func LoadTableGeocoder(path string) (*TableGeocoder, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("não foi possível abrir a tabela de CEPs: %w", err)
+	}
+	defer f.Close()
+
+	return NewTableGeocoder(f)
+}
+
+func (g *TableGeocoder) LookupCEP(ctx context.Context, cep string) (Point, error) {
+	cep, err := NormalizeCEP(cep)
+	if err != nil {
+		return Point{}, err
+	}
+
+	for n := len(cep); n > 0; n-- {
+		if p, ok := g.points[cep[:n]]; ok {
+			return p, nil
+		}
+	}
+
+	return Point{}, ErrNotFound
+}
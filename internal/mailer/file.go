@@ -0,0 +1,34 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync/atomic"
+	"time"
+)
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9@._-]`)
+
+// FileMailer grava cada mensagem como um arquivo .eml no diretório indicado,
+// para inspecionar os e-mails sem um servidor SMTP.
+type FileMailer struct {
+	dir string
+	seq atomic.Int64
+}
+
+func NewFileMailer(dir string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("não foi possível criar o diretório de e-mails: %w", err)
+	}
+	return &FileMailer{dir: dir}, nil
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	now := time.Now()
+	name := fmt.Sprintf("%s-%04d-%s.eml", now.Format("20060102T150405"), m.seq.Add(1), unsafeFileChars.ReplaceAllString(msg.To, "_"))
+
+	return os.WriteFile(filepath.Join(m.dir, name), buildMessage("", msg, now), 0o644)
+}
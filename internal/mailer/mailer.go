@@ -0,0 +1,32 @@
+package mailer
+
+import (
+	"context"
+	"log"
+)
+
+// Message é um e-mail em texto puro.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer envia e-mails. Os serviços dependem só desta interface, então em
+// desenvolvimento e nos testes dá para trocar o SMTP por LogMailer ou FileMailer.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// LogMailer só escreve a mensagem no log; útil para ver links de
+// verificação em desenvolvimento.
+type LogMailer struct{}
+
+func NewLogMailer() *LogMailer {
+	return &LogMailer{}
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	log.Printf("E-mail para %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
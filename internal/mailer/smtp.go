@@ -0,0 +1,100 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// SMTPMailer envia pelo servidor SMTP configurado. Com usuário definido
+// autentica com PLAIN, que o net/smtp só permite sobre TLS (STARTTLS) ou localhost.
+type SMTPMailer struct {
+	cfg SMTPConfig
+	// from é o remetente já validado; o envelope (MAIL FROM) leva só o
+	// endereço, e o cabeçalho From também o nome de exibição
+	from *mail.Address
+}
+
+// NewSMTPMailer valida o remetente, que pode vir como "Nome <endereco>".
+func NewSMTPMailer(cfg SMTPConfig) (*SMTPMailer, error) {
+	m := &SMTPMailer{cfg: cfg}
+	if cfg.From != "" {
+		from, err := mail.ParseAddress(cfg.From)
+		if err != nil {
+			return nil, fmt.Errorf("remetente inválido %q: %w", cfg.From, err)
+		}
+		m.from = from
+	}
+	return m, nil
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	var auth smtp.Auth
+	if m.cfg.Username != "" {
+		auth = smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)
+	}
+
+	addr := net.JoinHostPort(m.cfg.Host, strconv.Itoa(m.cfg.Port))
+
+	var envelopeFrom, headerFrom string
+	if m.from != nil {
+		envelopeFrom, headerFrom = m.from.Address, m.from.String()
+	}
+	body := buildMessage(headerFrom, msg, time.Now())
+
+	// net/smtp não aceita contexto, então o envio roda à parte e o contexto só
+	// limita quanto tempo esperamos
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(addr, auth, envelopeFrom, []string{msg.To}, body)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("falha ao enviar e-mail para %s: %w", msg.To, err)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// buildMessage monta a mensagem no formato RFC 5322, com assunto codificado
+// para aceitar acentos.
+func buildMessage(from string, msg Message, date time.Time) []byte {
+	var b bytes.Buffer
+	if from != "" {
+		fmt.Fprintf(&b, "From: %s\r\n", headerValue(from))
+	}
+	fmt.Fprintf(&b, "To: %s\r\n", headerValue(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", headerValue(msg.Subject)))
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(msg.Body)
+	return b.Bytes()
+}
+
+// headerValue remove quebras de linha para ninguém injetar cabeçalhos pelo
+// endereço ou pelo assunto.
+func headerValue(v string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(v)
+}